@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type sourceAdapter struct {
+	pattern     *regexp.Regexp
+	defaultRate float64
+	resolve     func(ctx context.Context, id string) (string, *requestError)
+	limiter     *rateLimiter
+	limiterOnce sync.Once
+}
+
+// sourceAdapters turn source=<adapter>:<id> into a texture URL. Each
+// adapter is rate limited on its own to SOURCE_RATE_<ADAPTER> requests per
+// second, since the services behind them have per-client limits.
+var sourceAdapters = map[string]*sourceAdapter{
+	"crafatar": {
+		pattern:     regexp.MustCompile(`^[0-9a-fA-F-]{32,36}$`),
+		defaultRate: 5,
+		resolve: func(_ context.Context, id string) (string, *requestError) {
+			return "https://crafatar.com/skins/" + id, nil
+		},
+	},
+	"minotar": {
+		pattern:     regexp.MustCompile(`^[0-9A-Za-z_-]{1,36}$`),
+		defaultRate: 5,
+		resolve: func(_ context.Context, id string) (string, *requestError) {
+			return "https://minotar.net/skin/" + id, nil
+		},
+	},
+	"mineskin": {
+		pattern:     regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`),
+		defaultRate: 1,
+		resolve:     resolveMineSkin,
+	},
+}
+
+// resolveSource maps a source=<adapter>:<id> value to the URL to hash.
+func resolveSource(ctx context.Context, source string) (string, *requestError) {
+	name, id, _ := strings.Cut(source, ":")
+	adapter, ok := sourceAdapters[strings.ToLower(name)]
+	if !ok {
+		return "", &requestError{status: http.StatusBadRequest, message: "Invalid source", details: "unknown source adapter " + name}
+	}
+	if !adapter.pattern.MatchString(id) {
+		return "", &requestError{status: http.StatusBadRequest, message: "Invalid source", details: "invalid " + name + " id"}
+	}
+
+	if wait, ok := adapter.rateLimiter(name).allow(); !ok {
+		reqErr := &requestError{status: http.StatusTooManyRequests, message: "Source rate limited", details: name}
+		return "", reqErr.withHeader("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+
+	return adapter.resolve(ctx, id)
+}
+
+func (adapter *sourceAdapter) rateLimiter(name string) *rateLimiter {
+	adapter.limiterOnce.Do(func() {
+		adapter.limiter = newRateLimiter(adapter.configuredRate(name))
+	})
+	return adapter.limiter
+}
+
+func (adapter *sourceAdapter) configuredRate(name string) float64 {
+	rate, err := strconv.ParseFloat(getEnvDefault("SOURCE_RATE_"+strings.ToUpper(name), ""), 64)
+	if err != nil || rate <= 0 {
+		return adapter.defaultRate
+	}
+	return rate
+}
+
+// resolveMineSkin looks up the texture URL of a MineSkin skin by its uuid.
+func resolveMineSkin(ctx context.Context, id string) (string, *requestError) {
+	apiURL := getEnvDefault("MINESKIN_API_URL", "https://api.mineskin.org") + "/v2/skins/" + url.PathEscape(id)
+	result, reqErr := fetchURL(ctx, apiURL)
+	if reqErr != nil {
+		return "", reqErr
+	}
+
+	var resp struct {
+		Skin struct {
+			Texture struct {
+				URL struct {
+					Skin string `json:"skin"`
+				} `json:"url"`
+			} `json:"texture"`
+		} `json:"skin"`
+	}
+	if err := json.Unmarshal(result.body, &resp); err != nil || resp.Skin.Texture.URL.Skin == "" {
+		return "", &requestError{status: http.StatusBadGateway, message: "Invalid MineSkin response", details: "no texture URL for " + id}
+	}
+	return resp.Skin.Texture.URL.Skin, nil
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second, holding
+// at most max(rate, 1) tokens.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := max(rate, 1)
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (l *rateLimiter) setRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.burst = max(rate, 1)
+	l.tokens = min(l.tokens, l.burst)
+}
+
+// allow takes a token if one is available, and otherwise reports how long
+// until the next one is.
+func (l *rateLimiter) allow() (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if l.tokens < 1 {
+		return time.Duration((1 - l.tokens) / l.rate * float64(time.Second)), false
+	}
+	l.tokens--
+	return 0, true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+)
+
+// adminListenerEnabled reports whether ADMIN_PORT is set, in which case
+// /stats, /admin/* and /debug/pprof/ are served only on ADMIN_HOST:ADMIN_PORT
+// and never on the public listener.
+func adminListenerEnabled() bool {
+	return getEnvDefault("ADMIN_PORT", "") != ""
+}
+
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", adminMiddleware(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", adminMiddleware(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", adminMiddleware(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", adminMiddleware(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", adminMiddleware(pprof.Trace))
+}
+
+// startAdminServer uses the second socket-activated listener when there
+// is one.
+func startAdminServer(mux *http.ServeMux, activated []net.Listener) *http.Server {
+	server := &http.Server{
+		Addr:              fmt.Sprintf("%s:%s", getEnvDefault("ADMIN_HOST", "127.0.0.1"), getEnv("ADMIN_PORT")),
+		Handler:           mux,
+		ReadHeaderTimeout: envDuration("READ_HEADER_TIMEOUT_MS", 5*time.Second),
+		Protocols:         serverProtocols("ADMIN_HTTP_PROTOCOLS", "http1"),
+	}
+
+	listener, err := listen(activated, 1, server.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		logInfof("Admin server running on http://%s", listener.Addr())
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	return server
+}
+
+// adminMiddleware guards operational endpoints with ADMIN_TOKEN, given as a
+// bearer token or as the HTTP Basic password (so browsers can open the
+// dashboard). Without a token configured every admin request is refused.
+func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := getEnvDefault("ADMIN_TOKEN", "")
+		if token == "" {
+			http.Error(w, `{"error": "Forbidden", "details": "admin endpoints are disabled"}`, http.StatusForbidden)
+			return
+		}
+
+		provided, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			provided = password
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="namemc-hash-api-admin"`)
+			w.Header().Add("WWW-Authenticate", `Basic realm="namemc-hash-api-admin"`)
+			http.Error(w, `{"error": "Unauthorized", "details": "invalid admin token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+)
+
+const maxAnimationFrames = 256
+
+var errAnimationTooLarge = errors.New("animation too large")
+
+// animationFrameHashes returns the alpha-normalized hash of every frame of
+// an animated GIF or APNG as it is displayed, i.e. composited over the
+// previous frames according to each frame's disposal and blend rules.
+// Each frame is hashed as soon as it is composited. Still images return
+// no hashes.
+func animationFrameHashes(imgBytes []byte, format string) ([]string, error) {
+	switch format {
+	case "gif":
+		return gifFrameHashes(imgBytes)
+	case "png":
+		return apngFrameHashes(imgBytes)
+	}
+	return nil, nil
+}
+
+// checkAnimationSize applies the MAX_IMAGE_PIXELS budget that
+// checkImageSize enforces on a still image to canvas pixels times frames,
+// the work compositing the animation takes.
+func checkAnimationSize(width int, height int, frames int) error {
+	if frames > maxAnimationFrames {
+		return fmt.Errorf("%w: more than %d frames", errAnimationTooLarge, maxAnimationFrames)
+	}
+	if limit := maxImagePixels(); int64(width)*int64(height)*int64(frames) > limit {
+		return fmt.Errorf("%w: %d frames of %dx%d exceed %d pixels", errAnimationTooLarge, frames, width, height, limit)
+	}
+	return nil
+}
+
+func gifFrameHashes(imgBytes []byte) ([]string, error) {
+	anim, err := gif.DecodeAll(bytes.NewReader(imgBytes))
+	if err != nil {
+		return nil, fmt.Errorf("gif decode failed: %v", err)
+	}
+	if len(anim.Image) < 2 {
+		return nil, nil
+	}
+	if err := checkAnimationSize(anim.Config.Width, anim.Config.Height, len(anim.Image)); err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, anim.Config.Width, anim.Config.Height))
+	hashes := make([]string, 0, len(anim.Image))
+	for i, frame := range anim.Image {
+		var disposal byte
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		hashes = append(hashes, alphaNormalizedHash(canvas))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return hashes, nil
+}
+
+// apngFrameHashes rebuilds each APNG frame as a standalone PNG (the frame's
+// IDAT/fdAT data behind a resized IHDR) so image/png can decode it.
+func apngFrameHashes(imgBytes []byte) ([]string, error) {
+	chunks, err := readPNGChunks(imgBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var ihdr []byte
+	var shared []pngChunk
+	var animated bool
+	type apngFrame struct {
+		control []byte
+		data    [][]byte
+	}
+	var frames []*apngFrame
+	var current *apngFrame
+
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "IHDR":
+			ihdr = chunk.data
+		case "PLTE", "tRNS":
+			shared = append(shared, chunk)
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if len(chunk.data) < 26 {
+				return nil, errors.New("invalid fcTL chunk")
+			}
+			if len(frames) == maxAnimationFrames {
+				return nil, fmt.Errorf("%w: more than %d frames", errAnimationTooLarge, maxAnimationFrames)
+			}
+			current = &apngFrame{control: chunk.data}
+			frames = append(frames, current)
+		case "IDAT":
+			// IDAT is only part of the animation when an fcTL precedes it.
+			if current != nil {
+				current.data = append(current.data, chunk.data)
+			}
+		case "fdAT":
+			if current == nil || len(chunk.data) < 4 {
+				return nil, errors.New("invalid fdAT chunk")
+			}
+			current.data = append(current.data, chunk.data[4:])
+		}
+	}
+	if !animated || len(frames) < 2 || len(ihdr) < 13 {
+		return nil, nil
+	}
+
+	width := binary.BigEndian.Uint32(ihdr[0:])
+	height := binary.BigEndian.Uint32(ihdr[4:])
+	if err := checkAnimationSize(int(width), int(height), len(frames)); err != nil {
+		return nil, err
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+
+	hashes := make([]string, 0, len(frames))
+	for i, frame := range frames {
+		fw := binary.BigEndian.Uint32(frame.control[4:])
+		fh := binary.BigEndian.Uint32(frame.control[8:])
+		fx := binary.BigEndian.Uint32(frame.control[12:])
+		fy := binary.BigEndian.Uint32(frame.control[16:])
+		disposeOp := frame.control[24]
+		blendOp := frame.control[25]
+
+		if uint64(fx)+uint64(fw) > uint64(width) || uint64(fy)+uint64(fh) > uint64(height) {
+			return nil, fmt.Errorf("frame %d lies outside the canvas", i)
+		}
+
+		frameIHDR := bytes.Clone(ihdr)
+		binary.BigEndian.PutUint32(frameIHDR[0:], fw)
+		binary.BigEndian.PutUint32(frameIHDR[4:], fh)
+
+		var buf bytes.Buffer
+		buf.Write(pngSignature)
+		writePNGChunk(&buf, "IHDR", frameIHDR)
+		for _, chunk := range shared {
+			writePNGChunk(&buf, chunk.kind, chunk.data)
+		}
+		writePNGChunk(&buf, "IDAT", bytes.Join(frame.data, nil))
+		writePNGChunk(&buf, "IEND", nil)
+
+		img, err := png.Decode(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d decode failed: %v", i, err)
+		}
+
+		rect := image.Rect(int(fx), int(fy), int(fx+fw), int(fy+fh))
+		// A first frame disposed to "previous" is treated as "background".
+		var previous *image.NRGBA
+		if disposeOp == 2 && i > 0 {
+			previous = cloneNRGBA(canvas)
+		}
+
+		op := draw.Src
+		if blendOp == 1 {
+			op = draw.Over
+		}
+		draw.Draw(canvas, rect, img, image.Point{}, op)
+		hashes = append(hashes, alphaNormalizedHash(canvas))
+
+		switch {
+		case previous != nil:
+			canvas = previous
+		case disposeOp == 1 || disposeOp == 2:
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return hashes, nil
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	clone := *img
+	clone.Pix = bytes.Clone(img.Pix)
+	return &clone
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCheckAnimationSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		frames        int
+		tooLarge      bool
+	}{
+		{"skin", 64, 64, maxAnimationFrames, false},
+		{"at budget", 256, 256, 256, false},
+		{"over budget", 512, 512, 256, true},
+		{"too many frames", 8, 8, maxAnimationFrames + 1, true},
+		{"tall canvas", 64, 1 << 16, 32, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAnimationSize(tt.width, tt.height, tt.frames)
+			if got := errors.Is(err, errAnimationTooLarge); got != tt.tooLarge {
+				t.Errorf("checkAnimationSize(%d, %d, %d) = %v, want too large %v", tt.width, tt.height, tt.frames, err, tt.tooLarge)
+			}
+		})
+	}
+}
+
+func TestHashErrorAnimationTooLarge(t *testing.T) {
+	if reqErr := hashError(checkAnimationSize(64, 1<<16, 32)); reqErr.status != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", reqErr.status)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Subject      string    `json:"subject,omitempty"`
+	RemoteAddr   string    `json:"remote_addr"`
+	Channel      string    `json:"channel"`
+	SourceURL    string    `json:"source_url,omitempty"`
+	UploadSHA256 string    `json:"upload_sha256,omitempty"`
+	StandardHash string    `json:"standard_hash,omitempty"`
+	AlphaHash    string    `json:"alpha_normalized_hash,omitempty"`
+	Status       int       `json:"status"`
+	ErrorMessage string    `json:"error,omitempty"`
+
+	ConfigChanges map[string]string `json:"config_changes,omitempty"`
+	Tag           string            `json:"tag,omitempty"`
+}
+
+// Audit entries go to one append-only NDJSON file per UTC day in
+// AUDIT_LOG_DIR; files older than AUDIT_LOG_RETENTION_DAYS are removed.
+var audit struct {
+	mu   sync.Mutex
+	day  string
+	file *os.File
+}
+
+func auditEnabled() bool {
+	return getEnvDefault("AUDIT_LOG_DIR", "") != ""
+}
+
+func auditHashRequest(r *http.Request, channel string, sourceURL string, upload []byte, hashes HashResponse, reqErr *requestError) {
+	if !auditEnabled() {
+		return
+	}
+
+	entry := AuditEntry{
+		Time:       time.Now().UTC(),
+		Subject:    requestSubject(r),
+		RemoteAddr: r.RemoteAddr,
+		Channel:    channel,
+		SourceURL:  sourceURL,
+		Status:     http.StatusOK,
+	}
+	if upload != nil {
+		entry.UploadSHA256 = sha256Hex(upload)
+	}
+	if reqErr != nil {
+		entry.Status = reqErr.status
+		entry.ErrorMessage = reqErr.message
+	} else {
+		entry.StandardHash = hashes.Standard
+		entry.AlphaHash = hashes.AlphaNormalized
+	}
+
+	writeAuditEntry(entry)
+}
+
+func writeAuditEntry(entry AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	day := entry.Time.Format("2006-01-02")
+	if audit.file == nil || audit.day != day {
+		if err := rotateAuditLog(day); err != nil {
+			logErrorf("Failed to open audit log: %v", err)
+			return
+		}
+	}
+
+	if _, err := audit.file.Write(append(line, '\n')); err != nil {
+		logErrorf("Failed to write audit log: %v", err)
+	}
+}
+
+func rotateAuditLog(day string) error {
+	dir := getEnvDefault("AUDIT_LOG_DIR", "")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, "audit-"+day+".ndjson"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if audit.file != nil {
+		audit.file.Close()
+	}
+	audit.file = file
+	audit.day = day
+
+	pruneAuditLogs(dir)
+	return nil
+}
+
+func pruneAuditLogs(dir string) {
+	days, err := strconv.Atoi(getEnvDefault("AUDIT_LOG_RETENTION_DAYS", "0"))
+	if err != nil || days <= 0 {
+		return
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+	matches, _ := filepath.Glob(filepath.Join(dir, "audit-*.ndjson"))
+	for _, path := range matches {
+		day := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "audit-"), ".ndjson")
+		if day < cutoff {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	batchWorkers      = 8
+	batchMaxBodyBytes = 8 << 20
+)
+
+type batchResult struct {
+	Index   int           `json:"index"`
+	URL     string        `json:"url"`
+	Hashes  *HashResponse `json:"hashes,omitempty"`
+	Plan    string        `json:"plan,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Details string        `json:"details,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []batchResult `json:"results"`
+	// Summary counts results by plan (and "failed") on dry runs.
+	Summary map[string]int `json:"summary,omitempty"`
+}
+
+// Dry-run plans: what a real run would do for a URL.
+const (
+	planCached    = "cached"
+	planFetch     = "fetch"
+	planDuplicate = "duplicate"
+)
+
+// handleHashBatch hashes up to HASH_BATCH_MAX_URLS (default 1000) URLs,
+// given as a JSON array of strings or, with Content-Type: text/plain, one
+// URL per line (blank lines and # comments are skipped). Each URL gets its
+// own REQUEST_TIMEOUT_MS and failures are reported per result. With
+// Accept: text/csv the results come back as CSV rows instead of JSON.
+// dry_run=true plans the batch instead of running it; see planBatchURL.
+// X-Request-Deadline-Ms bounds the whole batch rather than each URL, and
+// isn't capped at REQUEST_TIMEOUT_MS; URLs still unfinished at the
+// deadline fail with a timeout.
+func handleHashBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if deadline, ok, reqErr := clientDeadline(r); reqErr != nil {
+		reqErr.write(w)
+		return
+	} else if ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+
+	maxURLs, err := strconv.Atoi(getEnvDefault("HASH_BATCH_MAX_URLS", "1000"))
+	if err != nil || maxURLs <= 0 {
+		maxURLs = 1000
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, batchMaxBodyBytes))
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		uploadTooLargeError(batchMaxBodyBytes).write(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Invalid request body", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	urls, reqErr := parseBatchURLs(r.Header.Get("Content-Type"), body)
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+	if len(urls) == 0 || len(urls) > maxURLs {
+		http.Error(w, `{"error": "Invalid request body", "details": "between 1 and `+strconv.Itoa(maxURLs)+` URLs are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	opts := parseHashOptions(r)
+	opts.batch = true
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	results := make([]batchResult, len(urls))
+	seen := make(map[string]int, len(urls))
+	slots := make(chan struct{}, batchWorkers)
+	var wg sync.WaitGroup
+	for i, rawURL := range urls {
+		results[i] = batchResult{Index: i, URL: rawURL}
+		if dryRun {
+			// Repeats are only planned once; a real run would answer them
+			// from the cache.
+			cleanedURL := cacheURLFor(rawURL)
+			if first, ok := seen[cleanedURL]; ok {
+				results[i].Plan, results[i].Details = planDuplicate, "same as index "+strconv.Itoa(first)
+				continue
+			}
+			seen[cleanedURL] = i
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(result *batchResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+			defer cancel()
+
+			if dryRun {
+				var reqErr *requestError
+				result.Plan, result.Hashes, reqErr = planBatchURL(ctx, rawURL, opts)
+				if reqErr != nil {
+					result.Error, result.Details = reqErr.message, reqErr.details
+				}
+				return
+			}
+
+			started := time.Now()
+			hashes, source, reqErr := hashURL(ctx, rawURL, opts)
+			auditHashRequest(r, "batch", rawURL, nil, hashes, reqErr)
+			emitHashEvent("batch", rawURL, hashes, source, started, reqErr)
+			trackHashRequest(r, "batch", rawURL, reqErr)
+			if reqErr != nil {
+				result.Error, result.Details = reqErr.message, reqErr.details
+				return
+			}
+			result.Hashes = &hashes
+		}(&results[i])
+	}
+	wg.Wait()
+
+	resp := BatchResponse{Results: results}
+	if dryRun {
+		resp.Summary = make(map[string]int)
+		for _, result := range results {
+			if result.Error != "" {
+				resp.Summary["failed"]++
+			} else {
+				resp.Summary[result.Plan]++
+			}
+		}
+	}
+
+	if acceptsCSV(r) {
+		writeBatchCSV(w, results, dryRun)
+		return
+	}
+	writeSignedJSON(w, resp)
+}
+
+// planBatchURL checks rawURL the way hashURL would without fetching or
+// hashing it: the URL must normalize and pass the outbound host rules,
+// content already seen for it is reported as cached, and anything else
+// must answer a HEAD request with 200.
+func planBatchURL(ctx context.Context, rawURL string, opts hashOptions) (string, *HashResponse, *requestError) {
+	cleanedURL, err := normalizeURL(rawURL)
+	if err != nil {
+		return "", nil, &requestError{status: http.StatusBadRequest, message: "Invalid URL", details: err.Error()}
+	}
+
+	if contentSHA, ok := lookupURLContent(cleanedURL); ok {
+		if hashes, ok := lookupContent(contentSHA); ok {
+			hashes, reqErr := applyHashOptions(hashes, opts)
+			if reqErr != nil {
+				return "", nil, reqErr
+			}
+			return planCached, &hashes, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return "", nil, &requestError{status: http.StatusBadRequest, message: "Invalid URL", details: err.Error()}
+	}
+	if err := checkFetchURL(req.URL); err != nil {
+		return "", nil, &requestError{status: http.StatusForbidden, message: "URL not allowed", details: err.Error()}
+	}
+
+	limiter := hostLimiter(req.URL.Host)
+	if !limiter.acquire(timeUntilDeadline(ctx)) {
+		return "", nil, hostBusyError(req.URL.Host)
+	}
+	defer limiter.release()
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", nil, timeoutError()
+		}
+		return "", nil, &requestError{status: http.StatusBadRequest, message: "URL not reachable", details: err.Error()}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, &requestError{status: http.StatusBadRequest, message: "URL not reachable", details: "unexpected status " + strconv.Itoa(resp.StatusCode)}
+	}
+	return planFetch, nil, nil
+}
+
+func acceptsCSV(r *http.Request) bool {
+	for accepted := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(accepted); mediaType == "text/csv" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBatchCSV writes one input,standard_hash,alpha_normalized_hash,error
+// row per result, in input order, after a header row. Dry runs add a
+// plan column. Input and error cells are escaped with csvSafe.
+func writeBatchCSV(w http.ResponseWriter, results []batchResult, dryRun bool) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(w)
+	header := []string{"input", "standard_hash", "alpha_normalized_hash", "error"}
+	if dryRun {
+		header = append(header, "plan")
+	}
+	writer.Write(header)
+	for _, result := range results {
+		row := []string{csvSafe(result.URL), "", "", ""}
+		if dryRun {
+			row = append(row, result.Plan)
+		}
+		if result.Hashes != nil {
+			row[1], row[2] = result.Hashes.Standard, result.Hashes.AlphaNormalized
+		}
+		if result.Error != "" && result.Details != "" {
+			row[3] = csvSafe(result.Error + ": " + result.Details)
+		} else {
+			row[3] = csvSafe(result.Error)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+}
+
+// csvSafe prefixes cells that spreadsheets would read as a formula with
+// a quote, so a crafted URL can't run one when the CSV is opened. A
+// leading tab or carriage return counts too, since some spreadsheets
+// skip it and evaluate the rest.
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func parseBatchURLs(contentType string, body []byte) ([]string, *requestError) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "text/plain" {
+		var urls []string
+		for line := range strings.Lines(string(body)) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			urls = append(urls, line)
+		}
+		return urls, nil
+	}
+
+	var urls []string
+	if err := json.Unmarshal(body, &urls); err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: "Invalid request body", details: "expected a JSON array of URLs or text/plain with one URL per line"}
+	}
+	return urls, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteBatchCSVEscapesFormulas(t *testing.T) {
+	results := []batchResult{
+		{URL: "=HYPERLINK(\"http://evil\")", Error: "Invalid URL", Details: "bad"},
+		{URL: "+1", Error: "-oops"},
+		{URL: "@SUM(A1)"},
+		{URL: "\t=1+1"},
+		{URL: "\r=1+1"},
+		{URL: "http://example.com/skin.png", Hashes: &HashResponse{Standard: "aa", AlphaNormalized: "bb"}},
+	}
+
+	rec := httptest.NewRecorder()
+	writeBatchCSV(rec, results, false)
+
+	want := strings.Join([]string{
+		"input,standard_hash,alpha_normalized_hash,error",
+		`"'=HYPERLINK(""http://evil"")",,,Invalid URL: bad`,
+		"'+1,,,'-oops",
+		"'@SUM(A1),,,",
+		"'\t=1+1,,,",
+		"\"'\r=1+1\",,,",
+		"http://example.com/skin.png,aa,bb,",
+		"",
+	}, "\n")
+	if got := rec.Body.String(); got != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
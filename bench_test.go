@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+var benchSkins = []struct {
+	name string
+	file string
+}{
+	{"64x64", "conformance/skin_64x64.png"},
+	{"64x32", "conformance/legacy_64x32.png"},
+	{"HD", "conformance/hd_128x128.png"},
+}
+
+func loadBenchSkin(b *testing.B, file string) ([]byte, image.Image) {
+	b.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		b.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data, img
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, skin := range benchSkins {
+		b.Run(skin.name, func(b *testing.B) {
+			data, _ := loadBenchSkin(b, skin.file)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNormalize(b *testing.B) {
+	for _, skin := range benchSkins {
+		b.Run(skin.name, func(b *testing.B) {
+			_, img := loadBenchSkin(b, skin.file)
+			b.ReportAllocs()
+			for b.Loop() {
+				alphaNormalizedHash(toNRGBA(img))
+			}
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, skin := range benchSkins {
+		b.Run(skin.name, func(b *testing.B) {
+			_, img := loadBenchSkin(b, skin.file)
+			b.ReportAllocs()
+			var buffer bytes.Buffer
+			for b.Loop() {
+				buffer.Reset()
+				if err := imaging.Encode(&buffer, img, imaging.PNG); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkComputeHashes(b *testing.B) {
+	for _, skin := range benchSkins {
+		b.Run(skin.name, func(b *testing.B) {
+			data, _ := loadBenchSkin(b, skin.file)
+			opts := hashOptions{downscale: true, analysis: true}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := computeHashes(data, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const bloomHashes = 7
+
+// bloomFilter is a fixed-size Bloom filter over strings. Lookups always
+// probe bloomHashes bits, so they take the same time whatever the answer.
+type bloomFilter struct {
+	bits []atomic.Uint64
+	size uint64
+}
+
+var (
+	knownHashes     *bloomFilter
+	knownHashesOnce sync.Once
+)
+
+// knownFilter returns the process-wide filter of every hash seen, sized
+// by KNOWN_FILTER_BITS (default 2^24 bits, 2 MiB).
+func knownFilter() *bloomFilter {
+	knownHashesOnce.Do(func() {
+		size, err := strconv.ParseUint(getEnvDefault("KNOWN_FILTER_BITS", "16777216"), 10, 64)
+		if err != nil || size < 64 {
+			size = 1 << 24
+		}
+		knownHashes = &bloomFilter{bits: make([]atomic.Uint64, (size+63)/64), size: size}
+	})
+	return knownHashes
+}
+
+func (f *bloomFilter) positions(value string) [bloomHashes]uint64 {
+	h := fnv.New128a()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+	a, b := binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:])
+
+	var positions [bloomHashes]uint64
+	for i := range positions {
+		positions[i] = (a + uint64(i)*b) % f.size
+	}
+	return positions
+}
+
+func (f *bloomFilter) add(value string) {
+	for _, pos := range f.positions(value) {
+		f.bits[pos/64].Or(1 << (pos % 64))
+	}
+}
+
+// mayContain is false only for values that were definitely never added.
+func (f *bloomFilter) mayContain(value string) bool {
+	found := true
+	for _, pos := range f.positions(value) {
+		found = f.bits[pos/64].Load()&(1<<(pos%64)) != 0 && found
+	}
+	return found
+}
+
+// rememberHashes records every hash of a result that entered the cache.
+func rememberHashes(hashes HashResponse) {
+	filter := knownFilter()
+	filter.add(hashes.Standard)
+	filter.add(hashes.AlphaNormalized)
+	filter.add(hashes.AlphaNormalizedCompact)
+}
+
+func handleKnown(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		http.Error(w, `{"error": "Missing hash", "details": "hash query parameter is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]any{"hash": hash, "maybe_known": knownFilter().mayContain(hash)})
+}
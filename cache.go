@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+var cache sync.Map
+
+func contentCacheKey(contentSHA string) string {
+	return fmt.Sprintf("sha256:%s", contentSHA)
+}
+
+func urlCacheKey(cleanedURL string) string {
+	return fmt.Sprintf("url:%s", cleanedURL)
+}
+
+func lookupContent(contentSHA string) (HashResponse, bool) {
+	key := contentCacheKey(contentSHA)
+	if val, ok := cache.Load(key); ok {
+		return val.(HashResponse), true
+	}
+
+	if entry, ok := fetchFromPeer(key); ok && entry.Hashes != nil {
+		cache.Store(key, *entry.Hashes)
+		rememberHashes(*entry.Hashes)
+		return *entry.Hashes, true
+	}
+
+	return HashResponse{}, false
+}
+
+func storeContent(contentSHA string, hashes HashResponse) {
+	key := contentCacheKey(contentSHA)
+	cache.Store(key, hashes)
+	rememberHashes(hashes)
+	pushToPeer(key, peerCacheEntry{Hashes: &hashes})
+}
+
+func lookupURLContent(cleanedURL string) (string, bool) {
+	key := urlCacheKey(cleanedURL)
+	if val, ok := cache.Load(key); ok {
+		return val.(string), true
+	}
+
+	if entry, ok := fetchFromPeer(key); ok && entry.ContentSHA256 != "" {
+		cache.Store(key, entry.ContentSHA256)
+		return entry.ContentSHA256, true
+	}
+
+	return "", false
+}
+
+func storeURLContent(cleanedURL string, contentSHA string) {
+	key := urlCacheKey(cleanedURL)
+	cache.Store(key, contentSHA)
+	pushToPeer(key, peerCacheEntry{ContentSHA256: contentSHA})
+}
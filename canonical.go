@@ -0,0 +1,80 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// toNRGBA converts img to 8-bit non-premultiplied RGBA. Palette and
+// 16-bit images are converted channel by channel rather than through
+// draw.Draw, whose premultiplied round trip can shift semi-transparent
+// pixels by one, so every encoding of the same pixels yields the same
+// buffer. An *image.NRGBA with a zero origin is returned as is, so the
+// result must be treated as read-only.
+func toNRGBA(img image.Image) *image.NRGBA {
+	if src, ok := img.(*image.NRGBA); ok && src.Rect.Min == (image.Point{}) {
+		return src
+	}
+
+	bounds := img.Bounds()
+	out := image.NewNRGBA(bounds)
+
+	switch src := img.(type) {
+	case *image.Paletted:
+		palette := make([]color.NRGBA, len(src.Palette))
+		for i, c := range src.Palette {
+			palette[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				index := int(src.ColorIndexAt(x, y))
+				if index < len(palette) {
+					out.SetNRGBA(x, y, palette[index])
+				}
+			}
+		}
+	case *image.NRGBA64:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := src.NRGBA64At(x, y)
+				out.SetNRGBA(x, y, color.NRGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)})
+			}
+		}
+	case *image.RGBA64:
+		// image/png only produces RGBA64 for opaque 16-bit images, where
+		// premultiplied and straight values are the same.
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := src.RGBA64At(x, y)
+				if c.A == 0xffff {
+					out.SetNRGBA(x, y, color.NRGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), 0xff})
+				} else {
+					out.Set(x, y, c)
+				}
+			}
+		}
+	case *image.Gray16:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				v := uint8(src.Gray16At(x, y).Y >> 8)
+				out.SetNRGBA(x, y, color.NRGBA{v, v, v, 0xff})
+			}
+		}
+	default:
+		draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	}
+	return out
+}
+
+// zeroTransparentRow clears the colour of every fully transparent pixel
+// in a row of NRGBA bytes.
+func zeroTransparentRow(row []byte) {
+	for i := 0; i < len(row); i += 4 {
+		if row[i+3] == 0 {
+			row[i+0] = 0
+			row[i+1] = 0
+			row[i+2] = 0
+		}
+	}
+}
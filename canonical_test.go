@@ -0,0 +1,93 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestToNRGBA(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 1)
+
+	paletted := image.NewPaletted(rect, color.Palette{
+		color.NRGBA{R: 200, G: 100, B: 50, A: 255},
+		// Semi-transparent entries are what draw.Draw's premultiplied
+		// round trip used to shift by one.
+		color.NRGBA{R: 201, G: 103, B: 7, A: 3},
+	})
+	paletted.SetColorIndex(0, 0, 0)
+	paletted.SetColorIndex(1, 0, 1)
+
+	gray16 := image.NewGray16(rect)
+	gray16.SetGray16(0, 0, color.Gray16{Y: 0x12ff})
+	gray16.SetGray16(1, 0, color.Gray16{Y: 0xffff})
+
+	rgba64 := image.NewRGBA64(rect)
+	rgba64.SetRGBA64(0, 0, color.RGBA64{R: 0xabcd, G: 0x1234, B: 0x00ff, A: 0xffff})
+	rgba64.SetRGBA64(1, 0, color.RGBA64{R: 0x8000, G: 0x4000, B: 0, A: 0x8000})
+
+	nrgba64 := image.NewNRGBA64(rect)
+	nrgba64.SetNRGBA64(0, 0, color.NRGBA64{R: 0xc9ff, G: 0x67ff, B: 0x07ff, A: 0x03ff})
+	nrgba64.SetNRGBA64(1, 0, color.NRGBA64{R: 0xffff, G: 0, B: 0, A: 0})
+
+	tests := []struct {
+		name string
+		img  image.Image
+		want []color.NRGBA
+	}{
+		{"palette", paletted, []color.NRGBA{{200, 100, 50, 255}, {201, 103, 7, 3}}},
+		{"gray16", gray16, []color.NRGBA{{0x12, 0x12, 0x12, 255}, {255, 255, 255, 255}}},
+		{"rgba64", rgba64, []color.NRGBA{{0xab, 0x12, 0x00, 255}, {255, 127, 0, 128}}},
+		{"nrgba64", nrgba64, []color.NRGBA{{0xc9, 0x67, 0x07, 0x03}, {255, 0, 0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := toNRGBA(tt.img)
+			for x, want := range tt.want {
+				if got := out.NRGBAAt(x, 0); got != want {
+					t.Errorf("pixel %d = %v, want %v", x, got, want)
+				}
+			}
+		})
+	}
+}
+
+// The same pixels must hash the same however they were encoded.
+func TestAlphaNormalizedHashAcrossEncodings(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 2)
+	pixels := []color.NRGBA{{201, 103, 7, 3}, {10, 20, 30, 255}, {99, 99, 99, 0}, {1, 2, 3, 128}}
+
+	nrgba := image.NewNRGBA(rect)
+	paletted := image.NewPaletted(rect, nil)
+	nrgba64 := image.NewNRGBA64(rect)
+	for i, c := range pixels {
+		x, y := i%2, i/2
+		nrgba.SetNRGBA(x, y, c)
+		paletted.Palette = append(paletted.Palette, c)
+		paletted.SetColorIndex(x, y, uint8(i))
+		nrgba64.SetNRGBA64(x, y, color.NRGBA64{
+			R: uint16(c.R)<<8 | uint16(c.R), G: uint16(c.G)<<8 | uint16(c.G),
+			B: uint16(c.B)<<8 | uint16(c.B), A: uint16(c.A)<<8 | uint16(c.A),
+		})
+	}
+
+	want := alphaNormalizedHash(nrgba)
+	for name, img := range map[string]image.Image{"palette": paletted, "nrgba64": nrgba64} {
+		if got := alphaNormalizedHash(toNRGBA(img)); got != want {
+			t.Errorf("%s hash = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestAlphaNormalizedHashLeavesSourceIntact(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 10, G: 20, B: 30, A: 0})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 40, G: 50, B: 60, A: 255})
+	before := slices.Clone(img.Pix)
+
+	alphaNormalizedHash(img)
+	if !slices.Equal(img.Pix, before) {
+		t.Errorf("pixels changed to %v, want %v", img.Pix, before)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var captchaClient = &http.Client{Timeout: 5 * time.Second}
+
+var captchaVerifyURLs = map[string]string{
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+}
+
+// captchaEnabled reports whether CAPTCHA_PROVIDER (turnstile or hcaptcha)
+// and CAPTCHA_SECRET are set, in which case requests without a bearer
+// token must carry a CAPTCHA token instead.
+func captchaEnabled() bool {
+	return getEnvDefault("CAPTCHA_PROVIDER", "") != "" && getEnvDefault("CAPTCHA_SECRET", "") != ""
+}
+
+// verifyCaptcha checks the token from the X-Captcha-Token header (or the
+// provider's usual field name as a query parameter) with the provider's
+// siteverify endpoint.
+func verifyCaptcha(r *http.Request) error {
+	provider := strings.ToLower(getEnvDefault("CAPTCHA_PROVIDER", ""))
+	verifyURL, ok := captchaVerifyURLs[provider]
+	if !ok {
+		return fmt.Errorf("unknown CAPTCHA provider %q", provider)
+	}
+	verifyURL = getEnvDefault("CAPTCHA_VERIFY_URL", verifyURL)
+
+	token := r.Header.Get("X-Captcha-Token")
+	if token == "" {
+		token = r.URL.Query().Get("cf-turnstile-response")
+	}
+	if token == "" {
+		token = r.URL.Query().Get("h-captcha-response")
+	}
+	if token == "" {
+		return errors.New("missing CAPTCHA token")
+	}
+
+	form := url.Values{
+		"secret":   {getEnvDefault("CAPTCHA_SECRET", "")},
+		"response": {token},
+	}
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		form.Set("remoteip", ip)
+	}
+
+	resp, err := captchaClient.PostForm(verifyURL, form)
+	if err != nil {
+		return fmt.Errorf("CAPTCHA verification failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("CAPTCHA verification failed: %v", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("invalid CAPTCHA token (%s)", strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Package client is a small Go client for the namemc-hash-api HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HashResponse mirrors the server's hash response. Fields the server
+// wasn't asked for (or had no value for) are left empty.
+type HashResponse struct {
+	Standard               string   `json:"standard_hash,omitempty"`
+	StrippedStandard       string   `json:"stripped_standard_hash,omitempty"`
+	AlphaNormalized        string   `json:"alpha_normalized_hash"`
+	AlphaNormalizedCompact string   `json:"alpha_normalized_compact"`
+	ConvertedFrom          string   `json:"converted_from,omitempty"`
+	Frames                 []string `json:"frames,omitempty"`
+	FramesHash             string   `json:"frames_hash,omitempty"`
+	DownscaledHash         string   `json:"downscaled_hash,omitempty"`
+	IsDefaultSkin          *bool    `json:"is_default_skin,omitempty"`
+	DefaultSkin            string   `json:"default_skin,omitempty"`
+	HasNoiseRegions        *bool    `json:"has_noise_regions,omitempty"`
+	MirrorInvariant        string   `json:"mirror_invariant_hash,omitempty"`
+	HueInvariant           string   `json:"hue_invariant_hash,omitempty"`
+	Tags                   []Tag    `json:"tags,omitempty"`
+	Blocked                bool     `json:"blocked,omitempty"`
+}
+
+// Tag is a moderation label attached to a hash.
+type Tag struct {
+	Label     string    `json:"label"`
+	Note      string    `json:"note,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIError is returned when the server answers with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string `json:"error"`
+	Details    string `json:"details"`
+}
+
+func (e *APIError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("namemc-hash-api: %d %s: %s", e.StatusCode, e.Message, e.Details)
+	}
+	return fmt.Sprintf("namemc-hash-api: %d %s", e.StatusCode, e.Message)
+}
+
+// BatchResult is one URL's outcome from Batch; Hashes is nil when Error
+// is set.
+type BatchResult struct {
+	Index   int           `json:"index"`
+	URL     string        `json:"url"`
+	Hashes  *HashResponse `json:"hashes,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Details string        `json:"details,omitempty"`
+}
+
+type CompareImage struct {
+	Index   int           `json:"index"`
+	URL     string        `json:"url,omitempty"`
+	Hashes  *HashResponse `json:"hashes,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Details string        `json:"details,omitempty"`
+}
+
+// CompareResult holds Compare's pairwise matrices: Equal compares
+// alpha-normalized hashes and Distance counts differing pixels (-1 when
+// sizes differ or an image failed).
+type CompareResult struct {
+	Images   []CompareImage `json:"images"`
+	Equal    [][]bool       `json:"equal"`
+	Distance [][]int        `json:"distance"`
+}
+
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	MaxRetries int
+	RetryDelay time.Duration
+	// Token, when set, is sent as "Authorization: Bearer <Token>" for
+	// deployments that require a JWT.
+	Token string
+	// Header is added to every request, e.g. for a captcha token.
+	Header http.Header
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		MaxRetries: 2,
+		RetryDelay: 200 * time.Millisecond,
+	}
+}
+
+// HashURL asks the server to fetch and hash the skin at skinURL.
+func (c *Client) HashURL(ctx context.Context, skinURL string) (HashResponse, error) {
+	endpoint := c.BaseURL + "/hash?url=" + url.QueryEscape(skinURL)
+	var result HashResponse
+	err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	}, &result)
+	return result, err
+}
+
+// Hash uploads data as the "file" multipart field and returns its hashes.
+func (c *Client) Hash(ctx context.Context, data []byte) (HashResponse, error) {
+	body, contentType, err := multipartBody(data)
+	if err != nil {
+		return HashResponse{}, err
+	}
+
+	var result HashResponse
+	err = c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/hash", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return req, nil
+	}, &result)
+	return result, err
+}
+
+// HashReader reads r fully and uploads it like Hash, so retries can resend the body.
+func (c *Client) HashReader(ctx context.Context, r io.Reader) (HashResponse, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return HashResponse{}, err
+	}
+	return c.Hash(ctx, data)
+}
+
+// Batch asks the server to fetch and hash every URL in skinURLs. Per-URL
+// failures are reported in the results rather than as an error.
+func (c *Client) Batch(ctx context.Context, skinURLs []string) ([]BatchResult, error) {
+	var result struct {
+		Results []BatchResult `json:"results"`
+	}
+	err := c.postJSON(ctx, "/hash/batch", skinURLs, &result)
+	return result.Results, err
+}
+
+// Compare hashes the skins at skinURLs (at least two) and compares them
+// pairwise.
+func (c *Client) Compare(ctx context.Context, skinURLs []string) (CompareResult, error) {
+	var result CompareResult
+	err := c.postJSON(ctx, "/compare/matrix", map[string][]string{"urls": skinURLs}, &result)
+	return result, err
+}
+
+func (c *Client) postJSON(ctx context.Context, path string, payload any, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, out)
+}
+
+// do sends the request built by newRequest, retrying network errors, 5xx
+// and 429 responses, and decodes a successful response into out.
+func (c *Client) do(ctx context.Context, newRequest func() (*http.Request, error), out any) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.RetryDelay * time.Duration(1<<(attempt-1))):
+			}
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return err
+		}
+		for key, values := range c.Header {
+			req.Header[key] = values
+		}
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+
+		retry, err := c.send(req, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) send(req *http.Request, out any) (bool, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		body, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(body, apiErr) != nil {
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, apiErr
+	}
+
+	return false, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func multipartBody(data []byte) ([]byte, string, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	part, err := writer.CreateFormFile("file", "skin.png")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buffer.Bytes(), writer.FormDataContentType(), nil
+}
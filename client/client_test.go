@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientSendsTokenAndDecodesFullResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Captcha-Token") != "c" {
+			http.Error(w, `{"error": "Unauthorized", "details": "missing bearer token"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"standard_hash":"s","alpha_normalized_hash":"a","alpha_normalized_compact":"c",` +
+			`"downscaled_hash":"d","frames":["f1","f2"],"tags":[{"label":"nsfw","created_by":"mod","created_at":"2026-01-02T03:04:05Z"}],"blocked":true}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	if _, err := c.HashURL(context.Background(), "http://example.com/skin.png"); err == nil {
+		t.Fatal("request without a token succeeded")
+	}
+
+	c.Token = "secret"
+	c.Header = http.Header{"X-Captcha-Token": {"c"}}
+	hashes, err := c.HashURL(context.Background(), "http://example.com/skin.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes.DownscaledHash != "d" || len(hashes.Frames) != 2 || !hashes.Blocked || len(hashes.Tags) != 1 || hashes.Tags[0].Label != "nsfw" {
+		t.Errorf("decoded %+v", hashes)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const compareWorkers = 8
+
+type compareRequest struct {
+	URLs []string `json:"urls"`
+}
+
+type compareImage struct {
+	Index   int           `json:"index"`
+	URL     string        `json:"url,omitempty"`
+	Hashes  *HashResponse `json:"hashes,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Details string        `json:"details,omitempty"`
+
+	pixels *image.NRGBA
+}
+
+type CompareMatrixResponse struct {
+	Images   []compareImage `json:"images"`
+	Equal    [][]bool       `json:"equal"`
+	Distance [][]int        `json:"distance"`
+}
+
+// handleCompareMatrix hashes up to COMPARE_MAX_IMAGES images, given as
+// repeated "file" multipart fields or a JSON {"urls": [...]} body, and
+// returns pairwise matrices: equal compares alpha-normalized hashes and
+// distance counts differing pixels (-1 when sizes differ or an image
+// failed).
+func handleCompareMatrix(w http.ResponseWriter, r *http.Request) {
+	maxImages, err := strconv.Atoi(getEnvDefault("COMPARE_MAX_IMAGES", "100"))
+	if err != nil || maxImages <= 0 {
+		maxImages = 100
+	}
+
+	var images []compareImage
+	var uploads [][]byte
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		limit := maxUploadBytes()
+		r.Body = http.MaxBytesReader(nil, r.Body, int64(maxImages)*(limit+multipartOverheadBytes))
+		if err := r.ParseMultipartForm(multipartMemoryBytes()); err != nil {
+			if r.Context().Err() != nil {
+				timeoutError().write(w)
+				return
+			}
+			if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+				uploadTooLargeError(limit).write(w)
+				return
+			}
+			http.Error(w, `{"error": "Invalid request body", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		for _, header := range r.MultipartForm.File["file"] {
+			file, err := header.Open()
+			if err != nil {
+				http.Error(w, `{"error": "Failed to read uploaded file", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+				return
+			}
+			data, err := io.ReadAll(io.LimitReader(file, limit+1))
+			file.Close()
+			if err != nil {
+				http.Error(w, `{"error": "Failed to read uploaded file", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+				return
+			}
+			if int64(len(data)) > limit {
+				uploadTooLargeError(limit).write(w)
+				return
+			}
+			uploads = append(uploads, data)
+			images = append(images, compareImage{Index: len(images)})
+		}
+	} else {
+		var req compareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		for _, rawURL := range req.URLs {
+			images = append(images, compareImage{Index: len(images), URL: rawURL})
+		}
+	}
+
+	if len(images) < 2 || len(images) > maxImages {
+		http.Error(w, `{"error": "Invalid request body", "details": "between 2 and `+strconv.Itoa(maxImages)+` images are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	opts := parseHashOptions(r)
+	opts.batch = true
+	slots := make(chan struct{}, compareWorkers)
+	var wg sync.WaitGroup
+	for i := range images {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(img *compareImage) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			var data, upload []byte
+			var hashes HashResponse
+			var reqErr *requestError
+			if img.URL != "" {
+				var result fetchResult
+				result, reqErr = fetchURL(r.Context(), img.URL)
+				data = result.body
+			} else {
+				data = uploads[img.Index]
+				upload = data
+			}
+
+			if reqErr == nil {
+				hashes, _, reqErr = hashContent(data, opts)
+			}
+			auditHashRequest(r, "compare", img.URL, upload, hashes, reqErr)
+			if reqErr != nil {
+				img.Error, img.Details = reqErr.message, reqErr.details
+				return
+			}
+			img.Hashes = &hashes
+
+			if decoded, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+				img.pixels = toNRGBA(decoded)
+			}
+		}(&images[i])
+	}
+	wg.Wait()
+
+	resp := CompareMatrixResponse{
+		Images:   images,
+		Equal:    make([][]bool, len(images)),
+		Distance: make([][]int, len(images)),
+	}
+	for i := range images {
+		resp.Equal[i] = make([]bool, len(images))
+		resp.Distance[i] = make([]int, len(images))
+	}
+	for i := range images {
+		for j := i; j < len(images); j++ {
+			equal := images[i].Hashes != nil && images[j].Hashes != nil &&
+				images[i].Hashes.AlphaNormalized == images[j].Hashes.AlphaNormalized
+			distance := pixelDistance(images[i].pixels, images[j].pixels)
+			resp.Equal[i][j], resp.Equal[j][i] = equal, equal
+			resp.Distance[i][j], resp.Distance[j][i] = distance, distance
+		}
+	}
+
+	writeSignedJSON(w, resp)
+}
+
+// pixelDistance counts the pixels that differ between a and b after
+// alpha normalization, or returns -1 if either is missing or their sizes
+// differ.
+func pixelDistance(a *image.NRGBA, b *image.NRGBA) int {
+	if a == nil || b == nil || a.Bounds().Size() != b.Bounds().Size() {
+		return -1
+	}
+
+	pa, pb := canonicalPixels(a), canonicalPixels(b)
+	distance := 0
+	for i := 0; i < len(pa); i += 4 {
+		if !bytes.Equal(pa[i:i+4], pb[i:i+4]) {
+			distance++
+		}
+	}
+	return distance
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runtimeSetting is a config key that can be changed without a restart,
+// via PUT /admin/config or by editing .env and sending SIGHUP. validate
+// checks a new raw value ("" restores the default); apply pushes the value
+// now in env into whatever was built from it at startup.
+type runtimeSetting struct {
+	validate func(value string) error
+	apply    func()
+}
+
+var runtimeSettings = map[string]runtimeSetting{
+	"LOG_LEVEL": {validate: func(value string) error {
+		if _, ok := logLevels[value]; value != "" && !ok {
+			return errors.New("must be debug, info, warn or error")
+		}
+		return nil
+	}},
+	"FEATURE_FLAGS": {validate: validateFeatureFlags, apply: loadFeatureFlags},
+	"MAX_CONCURRENT_HASHES": {validate: validateNonNegativeInt, apply: func() {
+		limit, _ := strconv.Atoi(getEnvDefault("MAX_CONCURRENT_HASHES", "0"))
+		hashLimiter.setLimit(limit)
+	}},
+	"HASH_QUEUE_SIZE": {validate: validateNonNegativeInt, apply: func() {
+		queue, _ := strconv.Atoi(getEnvDefault("HASH_QUEUE_SIZE", "64"))
+		hashLimiter.setMaxQueue(queue)
+	}},
+	"FETCH_HOST_CONCURRENCY": {validate: validateNonNegativeInt, apply: func() {
+		limit, _ := strconv.Atoi(getEnvDefault("FETCH_HOST_CONCURRENCY", "8"))
+		hostLimiters.Range(func(_, val any) bool {
+			val.(*concurrencyLimiter).setLimit(limit)
+			return true
+		})
+	}},
+	"FETCH_HOST_QUEUE_SIZE": {validate: validateNonNegativeInt, apply: func() {
+		queue, _ := strconv.Atoi(getEnvDefault("FETCH_HOST_QUEUE_SIZE", "256"))
+		hostLimiters.Range(func(_, val any) bool {
+			val.(*concurrencyLimiter).setMaxQueue(queue)
+			return true
+		})
+	}},
+}
+
+func init() {
+	for name, adapter := range sourceAdapters {
+		runtimeSettings["SOURCE_RATE_"+strings.ToUpper(name)] = runtimeSetting{
+			validate: func(value string) error {
+				if value == "" {
+					return nil
+				}
+				if rate, err := strconv.ParseFloat(value, 64); err != nil || rate <= 0 {
+					return errors.New("must be a positive number")
+				}
+				return nil
+			},
+			apply: func() {
+				adapter.rateLimiter(name).setRate(adapter.configuredRate(name))
+			},
+		}
+	}
+}
+
+func validateNonNegativeInt(value string) error {
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return errors.New("must be a non-negative integer")
+	}
+	return nil
+}
+
+// currentRuntimeConfig returns the raw value of every runtime setting.
+func currentRuntimeConfig() map[string]string {
+	config := make(map[string]string, len(runtimeSettings))
+	for key := range runtimeSettings {
+		config[key] = getEnvDefault(key, "")
+	}
+	return config
+}
+
+// applyConfigChanges validates every change before applying any of them,
+// then records the change set in the log and the audit log.
+func applyConfigChanges(changes map[string]string, subject string, remoteAddr string) *requestError {
+	var errs []fieldError
+	for _, key := range slices.Sorted(maps.Keys(changes)) {
+		setting, ok := runtimeSettings[key]
+		if !ok {
+			errs = append(errs, fieldError{Field: key, Message: "cannot be changed at runtime"})
+			continue
+		}
+		if err := setting.validate(changes[key]); err != nil {
+			errs = append(errs, fieldError{Field: key, Message: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return &requestError{status: http.StatusUnprocessableEntity, message: "Validation failed", details: errs[0].Field + ": " + errs[0].Message, fields: errs}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	for key, value := range changes {
+		setEnv(key, value)
+	}
+	for key := range changes {
+		if apply := runtimeSettings[key].apply; apply != nil {
+			apply()
+		}
+	}
+
+	logInfof("Config changed by %s: %v", subject, changes)
+	if auditEnabled() {
+		writeAuditEntry(AuditEntry{
+			Time:          time.Now().UTC(),
+			Subject:       subject,
+			RemoteAddr:    remoteAddr,
+			Channel:       "config",
+			Status:        http.StatusOK,
+			ConfigChanges: changes,
+		})
+	}
+	return nil
+}
+
+func handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, currentRuntimeConfig())
+}
+
+// handlePutConfig takes a JSON object of setting names to new values.
+func handlePutConfig(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid request body", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	var changes map[string]string
+	if err := json.Unmarshal(body, &changes); err != nil {
+		http.Error(w, `{"error": "Invalid request body", "details": "expected an object of string values"}`, http.StatusBadRequest)
+		return
+	}
+
+	subject := requestSubject(r)
+	if subject == "" {
+		subject = "admin"
+	}
+	if reqErr := applyConfigChanges(changes, subject, r.RemoteAddr); reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	writeJSON(w, currentRuntimeConfig())
+}
+
+// watchConfigReload re-reads .env (and .env.local) on SIGHUP and applies any runtime
+// settings that changed. Other keys still need a restart.
+func watchConfigReload() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			values, err := readEnvFiles()
+			if err != nil {
+				logErrorf("Failed to reload .env file: %v", err)
+				continue
+			}
+
+			changes := make(map[string]string)
+			for key := range runtimeSettings {
+				if values[key] != getEnvDefault(key, "") {
+					changes[key] = values[key]
+				}
+			}
+			if reqErr := applyConfigChanges(changes, "SIGHUP", ""); reqErr != nil {
+				logWarnf("Config reload rejected: %s", reqErr.details)
+			}
+		}
+	}()
+}
+
+// validateConfig checks the whole configuration at startup and exits with
+// every problem found, rather than failing at first use.
+func validateConfig() {
+	var problems []string
+	check := func(key string, err error) {
+		if err != nil {
+			problems = append(problems, key+": "+err.Error())
+		}
+	}
+
+	check("PORT", validatePort(getEnvDefault("PORT", ""), true))
+	check("ADMIN_PORT", validatePort(getEnvDefault("ADMIN_PORT", ""), false))
+	if port := getEnvDefault("ADMIN_PORT", ""); port != "" && port == getEnvDefault("PORT", "") &&
+		getEnvDefault("ADMIN_HOST", "127.0.0.1") == getEnvDefault("HOST", "") {
+		problems = append(problems, "ADMIN_PORT: must differ from PORT")
+	}
+
+	check("HTTP_PROTOCOLS", validateProtocols(getEnvDefault("HTTP_PROTOCOLS", "")))
+	check("ADMIN_HTTP_PROTOCOLS", validateProtocols(getEnvDefault("ADMIN_HTTP_PROTOCOLS", "")))
+
+	for _, key := range slices.Sorted(maps.Keys(runtimeSettings)) {
+		check(key, runtimeSettings[key].validate(getEnvDefault(key, "")))
+	}
+	for _, key := range []string{
+		"MAX_UPLOAD_BYTES", "MAX_IMAGE_PIXELS", "MULTIPART_MEMORY_BYTES", "COMPARE_MAX_IMAGES", "NAMEMC_MAX_HASHES",
+		"KNOWN_FILTER_BITS", "EVENT_SINK_BATCH_SIZE", "EVENT_SINK_BUFFER", "WARMUP_CONCURRENCY",
+		"SUBSCRIPTION_HOST_CONCURRENCY", "WEBHOOK_MAX_ATTEMPTS", "RPC_MAX_BATCH", "HASH_BATCH_MAX_URLS",
+	} {
+		check(key, validatePositiveInt(getEnvDefault(key, "")))
+	}
+	for _, key := range []string{"MAX_REDIRECTS", "SUBSCRIPTION_MIN_INTERVAL", "REVALIDATE_MIN_HITS", "URL_CACHE_MAX_AGE", "AUDIT_LOG_RETENTION_DAYS"} {
+		check(key, validateNonNegativeInt(getEnvDefault(key, "")))
+	}
+	for _, key := range []string{"EVENT_SINK_FLUSH_MS", "READ_HEADER_TIMEOUT_MS", "REQUEST_TIMEOUT_MS", "STATSD_INTERVAL_MS", "VAULT_REFRESH_MS", "WEBHOOK_RETRY_BASE_MS"} {
+		check(key, validatePositiveInt(getEnvDefault(key, "")))
+	}
+	// Zero turns these off (or makes them immediate).
+	for _, key := range []string{"DNS_CACHE_TTL_MS", "HASH_QUEUE_TIMEOUT_MS", "IDEMPOTENCY_TTL_MS", "IDLE_TIMEOUT_MS", "NEGATIVE_CACHE_TTL_MS", "REVALIDATE_AFTER_MS"} {
+		check(key, validateNonNegativeInt(getEnvDefault(key, "")))
+	}
+	if jitter := getEnvDefault("SUBSCRIPTION_JITTER", ""); jitter != "" {
+		if value, err := strconv.ParseFloat(jitter, 64); err != nil || value < 0 || value >= 1 {
+			problems = append(problems, "SUBSCRIPTION_JITTER: must be a number in [0, 1)")
+		}
+	}
+
+	for _, key := range []string{"EVENT_SINK_URL", "JWT_JWKS_URL", "MINESKIN_API_URL", "CAPTCHA_VERIFY_URL", "VAULT_ADDR", "CACHE_SELF", "UPSTREAM_URL"} {
+		check(key, validateURL(getEnvDefault(key, "")))
+	}
+	for peer := range strings.SplitSeq(getEnvDefault("CACHE_PEERS", ""), ",") {
+		check("CACHE_PEERS", validateURL(strings.TrimSpace(peer)))
+	}
+	// /peer/cache is on the public listener, so it must never accept
+	// writes without the shared token.
+	if getEnvDefault("CACHE_PEERS", "") != "" && getEnvDefault("CACHE_PEER_TOKEN", "") == "" {
+		problems = append(problems, "CACHE_PEER_TOKEN: must be set when CACHE_PEERS is configured")
+	}
+	if textureURL := getEnvDefault("NAMEMC_TEXTURE_URL", ""); textureURL != "" && !strings.Contains(textureURL, "%s") {
+		problems = append(problems, "NAMEMC_TEXTURE_URL: must contain %s for the hash")
+	}
+
+	if format := getEnvDefault("EVENT_SINK_FORMAT", ""); format != "" && format != "ndjson" && format != "elasticsearch" {
+		problems = append(problems, "EVENT_SINK_FORMAT: must be ndjson or elasticsearch")
+	}
+	if mode := getEnvDefault("BLOCKLIST_MODE", ""); mode != "" && mode != "flag" && mode != "reject" {
+		problems = append(problems, "BLOCKLIST_MODE: must be flag or reject")
+	}
+	if key := getEnvDefault("RESPONSE_SIGNING_KEY", ""); key != "" {
+		if _, err := parseSigningKey(key); err != nil {
+			problems = append(problems, "RESPONSE_SIGNING_KEY: "+err.Error())
+		}
+	}
+
+	provider := strings.ToLower(getEnvDefault("CAPTCHA_PROVIDER", ""))
+	if _, ok := captchaVerifyURLs[provider]; provider != "" && !ok {
+		problems = append(problems, "CAPTCHA_PROVIDER: must be turnstile or hcaptcha")
+	}
+	if (provider == "") != (getEnvDefault("CAPTCHA_SECRET", "") == "") {
+		problems = append(problems, "CAPTCHA_PROVIDER and CAPTCHA_SECRET must be set together")
+	}
+	jwtKeys := getEnvDefault("JWT_HS256_SECRET", "") != "" || getEnvDefault("JWT_PUBLIC_KEY_FILE", "") != "" || getEnvDefault("JWT_JWKS_URL", "") != ""
+	if !jwtKeys && (getEnvDefault("JWT_ISSUER", "") != "" || getEnvDefault("JWT_AUDIENCE", "") != "") {
+		problems = append(problems, "JWT_ISSUER/JWT_AUDIENCE: set but no JWT_HS256_SECRET, JWT_PUBLIC_KEY_FILE or JWT_JWKS_URL to verify with")
+	}
+	if getEnvDefault("CACHE_PEERS", "") != "" && getEnvDefault("CACHE_SELF", "") == "" {
+		problems = append(problems, "CACHE_SELF: must be set when CACHE_PEERS is configured")
+	}
+	if getEnvDefault("ADMIN_PORT", "") != "" && getEnvDefault("ADMIN_TOKEN", "") == "" {
+		problems = append(problems, "ADMIN_TOKEN: must be set when ADMIN_PORT is configured")
+	}
+
+	if len(problems) > 0 {
+		log.Fatalf("Invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+}
+
+func validatePort(value string, required bool) error {
+	if value == "" {
+		if required {
+			return errors.New("must be set")
+		}
+		return nil
+	}
+	if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+		return errors.New("must be a port number")
+	}
+	return nil
+}
+
+func validatePositiveInt(value string) error {
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+		return errors.New("must be a positive integer")
+	}
+	return nil
+}
+
+func validateURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	if parsed, err := url.Parse(value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+	return nil
+}
+
+// serverProtocols reads a listener's protocol list from key: "http1",
+// "h2c" (cleartext HTTP/2 with prior knowledge; Upgrade: h2c is not
+// supported) or both, comma-separated. The default is http1 only.
+func serverProtocols(key string, fallback string) *http.Protocols {
+	protocols := new(http.Protocols)
+	for name := range strings.SplitSeq(getEnvDefault(key, fallback), ",") {
+		switch strings.TrimSpace(name) {
+		case "http1":
+			protocols.SetHTTP1(true)
+		case "h2c":
+			protocols.SetUnencryptedHTTP2(true)
+		}
+	}
+	return protocols
+}
+
+func validateProtocols(value string) error {
+	if value == "" {
+		return nil
+	}
+	for name := range strings.SplitSeq(value, ",") {
+		if name = strings.TrimSpace(name); name != "http1" && name != "h2c" {
+			return errors.New("must be a comma-separated list of http1 and h2c")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+)
+
+// conformanceCorpus holds skins with the hashes every deployment must
+// produce for them (conformance/expected.json). Regenerate the expected
+// values only for a deliberate change to the hash definitions.
+//
+//go:embed conformance
+var conformanceCorpus embed.FS
+
+type conformanceVector struct {
+	File     string            `json:"file"`
+	Expected map[string]string `json:"expected"`
+}
+
+type ConformanceMismatch struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+type ConformanceResult struct {
+	File       string                `json:"file"`
+	Passed     bool                  `json:"passed"`
+	Error      string                `json:"error,omitempty"`
+	Mismatches []ConformanceMismatch `json:"mismatches,omitempty"`
+}
+
+type ConformanceReport struct {
+	Passed  bool                `json:"passed"`
+	Total   int                 `json:"total"`
+	Failed  int                 `json:"failed"`
+	Results []ConformanceResult `json:"results"`
+}
+
+// runConformance hashes every corpus file with computeHashes directly,
+// bypassing the cache, and compares the fields listed for it.
+func runConformance() (ConformanceReport, error) {
+	manifest, err := conformanceCorpus.ReadFile("conformance/expected.json")
+	if err != nil {
+		return ConformanceReport{}, err
+	}
+	var vectors []conformanceVector
+	if err := json.Unmarshal(manifest, &vectors); err != nil {
+		return ConformanceReport{}, err
+	}
+
+	report := ConformanceReport{Passed: true, Total: len(vectors), Results: make([]ConformanceResult, 0, len(vectors))}
+	for _, vector := range vectors {
+		result := checkConformanceVector(vector)
+		if !result.Passed {
+			report.Passed = false
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func checkConformanceVector(vector conformanceVector) ConformanceResult {
+	result := ConformanceResult{File: vector.File}
+
+	data, err := conformanceCorpus.ReadFile(path.Join("conformance", vector.File))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	hashes, err := computeHashes(data, hashOptions{})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var actual map[string]any
+	encoded, _ := json.Marshal(hashes)
+	json.Unmarshal(encoded, &actual)
+
+	for field, expected := range vector.Expected {
+		value, _ := actual[field].(string)
+		if value != expected {
+			result.Mismatches = append(result.Mismatches, ConformanceMismatch{Field: field, Expected: expected, Actual: value})
+		}
+	}
+	result.Passed = len(result.Mismatches) == 0
+	return result
+}
+
+// handleConformance answers 500 when any vector fails so health checks
+// and deploy scripts can gate on it.
+func handleConformance(w http.ResponseWriter, r *http.Request) {
+	report, err := runConformance()
+	if err != nil {
+		http.Error(w, `{"error": "Failed to load conformance corpus", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Passed {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(report)
+}
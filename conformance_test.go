@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestConformance(t *testing.T) {
+	report, err := runConformance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total == 0 {
+		t.Fatal("conformance corpus is empty")
+	}
+	for _, result := range report.Results {
+		if result.Error != "" {
+			t.Errorf("%s: %s", result.File, result.Error)
+		}
+		for _, mismatch := range result.Mismatches {
+			t.Errorf("%s: %s = %s, want %s", result.File, mismatch.Field, mismatch.Actual, mismatch.Expected)
+		}
+	}
+	if !report.Passed {
+		t.Errorf("%d of %d vectors failed", report.Failed, report.Total)
+	}
+}
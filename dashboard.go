@@ -0,0 +1,144 @@
+package main
+
+import (
+	_ "embed"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	recentErrorsSize  = 50
+	topClientsSize    = 10
+	maxTrackedClients = 10000
+)
+
+//go:embed web/admin.html
+var adminHTML []byte
+
+type recentError struct {
+	Time      time.Time `json:"time"`
+	Client    string    `json:"client"`
+	Channel   string    `json:"channel"`
+	SourceURL string    `json:"source_url,omitempty"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error"`
+	Details   string    `json:"details,omitempty"`
+}
+
+type clientCount struct {
+	Client   string `json:"client"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+}
+
+type subscriptionHealth struct {
+	Total   int            `json:"total"`
+	Failing int            `json:"failing"`
+	Errors  []Subscription `json:"errors"`
+}
+
+type AdminSummary struct {
+	Stats         StatsResponse      `json:"stats"`
+	RecentErrors  []recentError      `json:"recent_errors"`
+	TopClients    []clientCount      `json:"top_clients"`
+	Subscriptions subscriptionHealth `json:"subscriptions"`
+}
+
+// activity keeps the last recentErrorsSize failed hash requests and
+// per-client request counts for the dashboard. Clients are JWT subjects,
+// or the remote IP for anonymous callers.
+var activity struct {
+	mu      sync.Mutex
+	errors  []recentError
+	clients map[string]*clientCount
+}
+
+func trackHashRequest(r *http.Request, channel string, sourceURL string, reqErr *requestError) {
+	client := requestSubject(r)
+	if client == "" {
+		client, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+
+	status := http.StatusOK
+	if reqErr != nil {
+		status = reqErr.status
+	}
+	logDebugf("%s request from %s for %q: %d", channel, client, sourceURL, status)
+
+	activity.mu.Lock()
+	defer activity.mu.Unlock()
+
+	if activity.clients == nil || len(activity.clients) >= maxTrackedClients {
+		activity.clients = make(map[string]*clientCount)
+	}
+	count, ok := activity.clients[client]
+	if !ok {
+		count = &clientCount{Client: client}
+		activity.clients[client] = count
+	}
+	count.Requests++
+
+	if reqErr == nil {
+		return
+	}
+	count.Errors++
+	if len(activity.errors) == recentErrorsSize {
+		activity.errors = activity.errors[1:]
+	}
+	activity.errors = append(activity.errors, recentError{
+		Time:      time.Now().UTC(),
+		Client:    client,
+		Channel:   channel,
+		SourceURL: sourceURL,
+		Status:    reqErr.status,
+		Error:     reqErr.message,
+		Details:   reqErr.details,
+	})
+}
+
+func handleAdminSummary(w http.ResponseWriter, r *http.Request) {
+	summary := AdminSummary{
+		Stats:         collectStats(),
+		TopClients:    []clientCount{},
+		Subscriptions: subscriptionHealth{Errors: []Subscription{}},
+	}
+
+	activity.mu.Lock()
+	summary.RecentErrors = append([]recentError{}, activity.errors...)
+	for _, count := range activity.clients {
+		summary.TopClients = append(summary.TopClients, *count)
+	}
+	activity.mu.Unlock()
+
+	slices.Reverse(summary.RecentErrors)
+	slices.SortFunc(summary.TopClients, func(a, b clientCount) int {
+		return int(b.Requests - a.Requests)
+	})
+	if len(summary.TopClients) > topClientsSize {
+		summary.TopClients = summary.TopClients[:topClientsSize]
+	}
+
+	subscriptionsMu.Lock()
+	summary.Subscriptions.Total = len(subscriptions)
+	for _, sub := range subscriptions {
+		if sub.LastError != "" {
+			summary.Subscriptions.Failing++
+			snapshot := *sub
+			snapshot.WebhookSecret = ""
+			summary.Subscriptions.Errors = append(summary.Subscriptions.Errors, snapshot)
+		}
+	}
+	subscriptionsMu.Unlock()
+
+	writeJSON(w, summary)
+}
+
+// handleAdminDashboard serves the HTML dashboard, which renders
+// /admin/summary.
+func handleAdminDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(adminHTML)
+}
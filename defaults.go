@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSkins maps the alpha-normalized hash of each default skin to its
+// name. It is filled once at startup and only read afterwards.
+var defaultSkins map[string]string
+
+// loadDefaultSkins hashes every PNG in DEFAULT_SKINS_DIR, naming each
+// default after its file (steve.png -> "steve"). Point it at the default
+// textures extracted from the client jar (assets/minecraft/textures/entity/player).
+func loadDefaultSkins() {
+	dir := getEnvDefault("DEFAULT_SKINS_DIR", "")
+	if dir == "" {
+		return
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		logErrorf("Failed to list default skins: %v", err)
+		return
+	}
+
+	skins := make(map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logErrorf("Failed to read default skin %s: %v", path, err)
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			logErrorf("Failed to decode default skin %s: %v", path, err)
+			continue
+		}
+		skins[alphaNormalizedHash(toNRGBA(img))] = strings.TrimSuffix(filepath.Base(path), ".png")
+	}
+
+	defaultSkins = skins
+	logInfof("Loaded %d default skins", len(skins))
+}
+
+// matchDefaultSkin reports which default skin hashes matches, also
+// comparing the downscaled hash so HD re-exports of a default are caught.
+func matchDefaultSkin(hashes HashResponse) (string, bool) {
+	if defaultSkins == nil {
+		return "", false
+	}
+	if name, ok := defaultSkins[hashes.AlphaNormalized]; ok {
+		return name, true
+	}
+	if hashes.DownscaledHash != "" {
+		if name, ok := defaultSkins[hashes.DownscaledHash]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type dnsCacheEntry struct {
+	addrs     []string
+	expiresAt time.Time
+}
+
+var (
+	dnsCache   = make(map[string]dnsCacheEntry)
+	dnsCacheMu sync.Mutex
+	dialer     = &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+)
+
+// cachedDialContext resolves hosts through an in-process cache. Go's
+// resolver doesn't expose record TTLs, so entries live for
+// DNS_CACHE_TTL_MS (default 60s); if a refresh fails the expired addresses
+// are still used rather than failing the fetch. Every resolved address is
+// checked against checkDialAddress before connecting.
+func cachedDialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	ttl := envDuration("DNS_CACHE_TTL_MS", time.Minute)
+	switch {
+	case net.ParseIP(host) != nil:
+		addrs = []string{host}
+	case ttl <= 0:
+		addrs, err = net.DefaultResolver.LookupHost(ctx, host)
+	default:
+		addrs, err = resolveCached(ctx, host, ttl)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, addr := range addrs {
+		if dialErr = checkDialAddress(addr); dialErr != nil {
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	return nil, dialErr
+}
+
+func resolveCached(ctx context.Context, host string, ttl time.Duration) ([]string, error) {
+	dnsCacheMu.Lock()
+	entry, ok := dnsCache[host]
+	dnsCacheMu.Unlock()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = errors.New("no addresses found for " + host)
+	}
+	if err != nil {
+		if ok {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	dnsCacheMu.Lock()
+	dnsCache[host] = dnsCacheEntry{addrs: addrs, expiresAt: time.Now().Add(ttl)}
+	dnsCacheMu.Unlock()
+	return addrs, nil
+}
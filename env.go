@@ -2,44 +2,238 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	env = make(map[string]string)
+	env   = make(map[string]string)
+	envMu sync.RWMutex
 )
 
 func loadEnvironment() {
-	file, err := os.Open(".env")
+	values, err := readEnvFiles()
 	if err != nil {
-		log.Fatal("Failed to open .env file:", err)
+		log.Fatal("Failed to read .env file:", err)
+	}
+
+	if err := resolveSecretFiles(values); err != nil {
+		log.Fatal(err)
+	}
+
+	envMu.Lock()
+	env = values
+	envMu.Unlock()
+}
+
+// secretEnvKeys can instead be given as <KEY>_FILE naming a file that
+// holds the value (e.g. a Docker secret under /run/secrets), so the
+// secret itself never appears in .env or the process environment.
+var secretEnvKeys = []string{
+	"ADMIN_TOKEN",
+	"CACHE_PEER_TOKEN",
+	"CAPTCHA_SECRET",
+	"EVENT_SINK_AUTHORIZATION",
+	"JWT_HS256_SECRET",
+	"MINESKIN_API_KEY",
+	"RESPONSE_SIGNING_KEY",
+	"UPSTREAM_TOKEN",
+	"VAULT_TOKEN",
+	"WEBHOOK_SECRET",
+}
+
+func resolveSecretFiles(values map[string]string) error {
+	for _, key := range secretEnvKeys {
+		path := values[key+"_FILE"]
+		if path == "" {
+			path = os.Getenv(key + "_FILE")
+		}
+		if path == "" {
+			continue
+		}
+		if values[key] != "" {
+			return fmt.Errorf("both %s and %s_FILE are set", key, key)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_FILE: %w", key, err)
+		}
+		values[key] = strings.TrimRight(string(data), "\r\n")
+	}
+	return nil
+}
+
+// readEnvFiles reads .env and then, if present, .env.local, whose values
+// override it. Later lines can interpolate earlier ones.
+func readEnvFiles() (map[string]string, error) {
+	values := make(map[string]string)
+	if err := readEnvFile(".env", values); err != nil {
+		return nil, err
+	}
+	if err := readEnvFile(".env.local", values); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return values, nil
+}
+
+// readEnvFile parses KEY=value lines into values. Blank lines and lines
+// starting with # are skipped and an "export " prefix is ignored. Values
+// may be single-quoted (taken literally), double-quoted (with \n, \t, \",
+// \\ and \$ escapes) or bare, where a " #" starts a trailing comment.
+// ${VAR} in double-quoted and bare values expands to an earlier value or,
+// failing that, the process environment.
+func readEnvFile(path string, values map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
 	}
 	defer file.Close()
 
 	var buffer bytes.Buffer
 	_, err = io.Copy(&buffer, file)
 	if err != nil {
-		log.Fatal("Failed to read .env file:", err)
+		return err
 	}
 
 	lines := strings.SplitSeq(buffer.String(), "\n")
 	for line := range lines {
 		line = strings.TrimSpace(line)
-		if strings.Contains(line, "=") {
-			parts := strings.SplitN(line, "=", 2)
-			env[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
 		}
+		key = strings.TrimSpace(key)
+		values[key] = parseEnvValue(strings.TrimSpace(raw), values)
 	}
+	return nil
+}
+
+func parseEnvValue(raw string, values map[string]string) string {
+	lookup := func(name string) string {
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	}
+
+	switch {
+	case len(raw) >= 2 && raw[0] == '\'':
+		if end := strings.IndexByte(raw[1:], '\''); end >= 0 {
+			return raw[1 : end+1]
+		}
+	case len(raw) >= 2 && raw[0] == '"':
+		var value strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			if c == '"' {
+				break
+			}
+			if c == '\\' && i+1 < len(raw) {
+				i++
+				switch raw[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				case '$':
+					// Keep the escaped dollar from being expanded below.
+					value.WriteString("$$")
+				default:
+					value.WriteByte(raw[i])
+				}
+				continue
+			}
+			value.WriteByte(c)
+		}
+		return expandEnvValue(value.String(), lookup)
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return expandEnvValue(raw, lookup)
+}
+
+// expandEnvValue replaces ${VAR} with its value. "$$" is a literal "$";
+// a "$" not followed by "{" is left alone.
+func expandEnvValue(value string, lookup func(string) string) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+
+	var expanded strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			expanded.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case '$':
+			expanded.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				expanded.WriteString(value[i:])
+				return expanded.String()
+			}
+			expanded.WriteString(lookup(value[i+2 : i+2+end]))
+			i += end + 2
+		default:
+			expanded.WriteByte('$')
+		}
+	}
+	return expanded.String()
+}
+
+func setEnv(key string, value string) {
+	envMu.Lock()
+	defer envMu.Unlock()
+	env[key] = value
 }
 
 func getEnv(key string) string {
-	if value, exists := env[key]; exists {
+	envMu.RLock()
+	value, exists := env[key]
+	envMu.RUnlock()
+	if exists {
 		return value
 	}
 
-	log.Printf("Warning: Environment variable %s not found\n", key)
+	logWarnf("Warning: Environment variable %s not found\n", key)
 	return ""
 }
+
+func getEnvDefault(key string, fallback string) string {
+	envMu.RLock()
+	value, exists := env[key]
+	envMu.RUnlock()
+	if exists && value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	ms, err := strconv.Atoi(getEnvDefault(key, ""))
+	if err != nil {
+		return fallback
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
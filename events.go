@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// HashEvent is one row per hash request, written as JSON lines so it can
+// go straight into ClickHouse (INSERT ... FORMAT JSONEachRow, with
+// date_time_input_format=best_effort) or any HTTP endpoint taking NDJSON.
+type HashEvent struct {
+	Time         time.Time `json:"time"`
+	Channel      string    `json:"channel"`
+	SourceURL    string    `json:"source_url"`
+	StandardHash string    `json:"standard_hash"`
+	AlphaHash    string    `json:"alpha_normalized_hash"`
+	LatencyMs    float64   `json:"latency_ms"`
+	CacheStatus  string    `json:"cache_status"`
+	Status       int       `json:"status"`
+	Error        string    `json:"error"`
+}
+
+type eventSinkStats struct {
+	Sent    int64 `json:"sent"`
+	Dropped int64 `json:"dropped"`
+	Failed  int64 `json:"failed"`
+}
+
+var eventSink struct {
+	url     string
+	events  chan HashEvent
+	client  *http.Client
+	sent    atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// startEventSink POSTs hash events in NDJSON batches to EVENT_SINK_URL,
+// flushing every EVENT_SINK_BATCH_SIZE events (default 500) or
+// EVENT_SINK_FLUSH_MS (default 1000). Events are buffered up to
+// EVENT_SINK_BUFFER (default 10000) and dropped rather than ever blocking
+// a request; failed batches are logged and discarded.
+//
+// With EVENT_SINK_FORMAT=elasticsearch each batch is an Elasticsearch /
+// OpenSearch bulk request instead: EVENT_SINK_URL should point at the
+// cluster's _bulk endpoint, documents go to EVENT_SINK_INDEX (default
+// namemc-hashes) and EVENT_SINK_AUTHORIZATION, if set, is sent as the
+// Authorization header (e.g. "ApiKey ...").
+func startEventSink() {
+	sinkURL := getEnvDefault("EVENT_SINK_URL", "")
+	if sinkURL == "" {
+		return
+	}
+
+	batchSize, err := strconv.Atoi(getEnvDefault("EVENT_SINK_BATCH_SIZE", "500"))
+	if err != nil || batchSize <= 0 {
+		batchSize = 500
+	}
+	bufferSize, err := strconv.Atoi(getEnvDefault("EVENT_SINK_BUFFER", "10000"))
+	if err != nil || bufferSize <= 0 {
+		bufferSize = 10000
+	}
+	interval := envDuration("EVENT_SINK_FLUSH_MS", time.Second)
+
+	eventSink.url = sinkURL
+	eventSink.client = &http.Client{Timeout: 10 * time.Second}
+	eventSink.events = make(chan HashEvent, bufferSize)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		batch := make([]HashEvent, 0, batchSize)
+		for {
+			select {
+			case event := <-eventSink.events:
+				batch = append(batch, event)
+				if len(batch) < batchSize {
+					continue
+				}
+			case <-ticker.C:
+				if len(batch) == 0 {
+					continue
+				}
+			}
+
+			if err := sendEventBatch(batch); err != nil {
+				eventSink.failed.Add(int64(len(batch)))
+				logErrorf("Failed to send %d events: %v", len(batch), err)
+			} else {
+				eventSink.sent.Add(int64(len(batch)))
+			}
+			batch = batch[:0]
+		}
+	}()
+}
+
+func emitHashEvent(channel string, sourceURL string, hashes HashResponse, source SourceInfo, started time.Time, reqErr *requestError) {
+	if eventSink.events == nil {
+		return
+	}
+
+	event := HashEvent{
+		Time:        time.Now().UTC(),
+		Channel:     channel,
+		SourceURL:   sourceURL,
+		LatencyMs:   float64(time.Since(started).Microseconds()) / 1000,
+		CacheStatus: "miss",
+		Status:      http.StatusOK,
+	}
+	if source.Cached {
+		event.CacheStatus = "hit"
+	}
+	if reqErr != nil {
+		event.Status = reqErr.status
+		event.Error = reqErr.message
+	} else {
+		event.StandardHash = hashes.Standard
+		event.AlphaHash = hashes.AlphaNormalized
+	}
+
+	select {
+	case eventSink.events <- event:
+	default:
+		eventSink.dropped.Add(1)
+	}
+}
+
+func sendEventBatch(batch []HashEvent) error {
+	bulk := getEnvDefault("EVENT_SINK_FORMAT", "ndjson") == "elasticsearch"
+	action := map[string]any{"index": map[string]string{"_index": getEnvDefault("EVENT_SINK_INDEX", "namemc-hashes")}}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, event := range batch {
+		if bulk {
+			if err := encoder.Encode(action); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, eventSink.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if authorization := getEnvDefault("EVENT_SINK_AUTHORIZATION", ""); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := eventSink.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	// Bulk requests succeed as a whole even when items are rejected.
+	if bulk {
+		var result struct {
+			Errors bool `json:"errors"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(&result); err != nil {
+			return fmt.Errorf("invalid bulk response: %v", err)
+		}
+		if result.Errors {
+			return errors.New("bulk request had item errors")
+		}
+	}
+	return nil
+}
+
+func currentEventSinkStats() *eventSinkStats {
+	if eventSink.events == nil {
+		return nil
+	}
+	return &eventSinkStats{
+		Sent:    eventSink.sent.Load(),
+		Dropped: eventSink.dropped.Load(),
+		Failed:  eventSink.failed.Load(),
+	}
+}
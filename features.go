@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// featureDefaults lists every feature flag and whether it is on when
+// FEATURE_FLAGS doesn't mention it. Flags gate optional parts of the hash
+// computation; results already cached keep the fields they were computed
+// with.
+var featureDefaults = map[string]bool{
+	"animation_frames":   true,
+	"default_skin_match": true,
+	"invariant_hashes":   true,
+	"noise_regions":      true,
+}
+
+// parseFeatureFlags reads a comma-separated list like
+// "noise_regions=false,animation_frames" (a bare name means on).
+func parseFeatureFlags(value string) (map[string]bool, error) {
+	flags := maps.Clone(featureDefaults)
+	for entry := range strings.SplitSeq(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, setting, hasSetting := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if _, ok := featureDefaults[name]; !ok {
+			return nil, fmt.Errorf("unknown feature %q", name)
+		}
+		enabled := true
+		if hasSetting {
+			switch strings.TrimSpace(setting) {
+			case "true", "on", "1":
+			case "false", "off", "0":
+				enabled = false
+			default:
+				return nil, fmt.Errorf("invalid setting for feature %q", name)
+			}
+		}
+		flags[name] = enabled
+	}
+	return flags, nil
+}
+
+var (
+	enabledFeatures   = maps.Clone(featureDefaults)
+	enabledFeaturesMu sync.RWMutex
+)
+
+// loadFeatureFlags parses FEATURE_FLAGS once, at startup and whenever the
+// setting is changed at runtime; both paths have validated it already.
+func loadFeatureFlags() {
+	flags, err := parseFeatureFlags(getEnvDefault("FEATURE_FLAGS", ""))
+	if err != nil {
+		logErrorf("Ignoring invalid FEATURE_FLAGS: %v", err)
+		return
+	}
+	enabledFeaturesMu.Lock()
+	enabledFeatures = flags
+	enabledFeaturesMu.Unlock()
+}
+
+// featureFlags returns the flags in effect. The map is shared and must not
+// be modified.
+func featureFlags() map[string]bool {
+	enabledFeaturesMu.RLock()
+	defer enabledFeaturesMu.RUnlock()
+	return enabledFeatures
+}
+
+func validateFeatureFlags(value string) error {
+	_, err := parseFeatureFlags(value)
+	return err
+}
+
+type FeatureFlag struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Default bool   `json:"default"`
+}
+
+func handleFeatures(w http.ResponseWriter, r *http.Request) {
+	flags := featureFlags()
+	list := make([]FeatureFlag, 0, len(flags))
+	for _, name := range slices.Sorted(maps.Keys(flags)) {
+		list = append(list, FeatureFlag{Name: name, Enabled: flags[name], Default: featureDefaults[name]})
+	}
+	writeJSON(w, list)
+}
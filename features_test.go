@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestFeatureFlagsFollowRuntimeChanges(t *testing.T) {
+	defer applyConfigChanges(map[string]string{"FEATURE_FLAGS": ""}, "test", "")
+
+	if reqErr := applyConfigChanges(map[string]string{"FEATURE_FLAGS": "noise_regions=false"}, "test", ""); reqErr != nil {
+		t.Fatalf("applyConfigChanges: %v", reqErr.details)
+	}
+	if flags := featureFlags(); flags["noise_regions"] || !flags["animation_frames"] {
+		t.Errorf("flags = %v, want only noise_regions off", flags)
+	}
+
+	if reqErr := applyConfigChanges(map[string]string{"FEATURE_FLAGS": "bogus"}, "test", ""); reqErr == nil {
+		t.Fatal("invalid FEATURE_FLAGS was accepted")
+	}
+	if flags := featureFlags(); flags["noise_regions"] {
+		t.Errorf("flags = %v after a rejected change, want noise_regions still off", flags)
+	}
+}
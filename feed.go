@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type FeedEvent struct {
+	HashResponse
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+var (
+	seenHashes      sync.Map
+	feedListeners   = make(map[chan FeedEvent]struct{})
+	feedListenersMu sync.Mutex
+)
+
+// observeHash publishes hashes to /feed listeners the first time their
+// alpha-normalized hash is computed by this process.
+func observeHash(hashes HashResponse) {
+	if _, seen := seenHashes.LoadOrStore(hashes.AlphaNormalized, struct{}{}); seen {
+		return
+	}
+
+	event := FeedEvent{HashResponse: hashes, ObservedAt: time.Now().UTC()}
+
+	feedListenersMu.Lock()
+	defer feedListenersMu.Unlock()
+	for listener := range feedListeners {
+		select {
+		case listener <- event:
+		default:
+		}
+	}
+}
+
+func handleFeed(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error": "Streaming unsupported", "details": ""}`, http.StatusInternalServerError)
+		return
+	}
+
+	listener := make(chan FeedEvent, 64)
+	feedListenersMu.Lock()
+	feedListeners[listener] = struct{}{}
+	feedListenersMu.Unlock()
+
+	defer func() {
+		feedListenersMu.Lock()
+		delete(feedListeners, listener)
+		feedListenersMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event := <-listener:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: hash\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
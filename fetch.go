@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	fetchClient = &http.Client{Transport: newFetchTransport(), CheckRedirect: checkRedirect}
+
+	negativeCache       sync.Map
+	negativeCacheStores atomic.Int64
+
+	hostLimiters sync.Map
+)
+
+type fetchResult struct {
+	body         []byte
+	finalURL     string
+	status       int
+	duration     time.Duration
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+type negativeCacheEntry struct {
+	err       *requestError
+	expiresAt time.Time
+}
+
+func newFetchTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = cachedDialContext
+	return transport
+}
+
+func requestTimeout() time.Duration {
+	return envDuration("REQUEST_TIMEOUT_MS", 10*time.Second)
+}
+
+// fetchURL remembers upstream failures (bad statuses, DNS and connection
+// errors) for NEGATIVE_CACHE_TTL_MS so bursts for a dead URL only reach
+// the upstream host once. Responses carry X-Negative-Cache: HIT or MISS.
+func fetchURL(ctx context.Context, rawURL string) (fetchResult, *requestError) {
+	return fetchURLConditional(ctx, rawURL, urlValidators{})
+}
+
+// fetchURLConditional sends If-None-Match/If-Modified-Since for the given
+// validators; a 304 answer comes back as a result with notModified set.
+func fetchURLConditional(ctx context.Context, rawURL string, validators urlValidators) (fetchResult, *requestError) {
+	// Failures are remembered per normalized URL, like the URL cache.
+	negativeKey := cacheURLFor(rawURL)
+	if val, ok := negativeCache.Load(negativeKey); ok {
+		entry := val.(negativeCacheEntry)
+		if time.Now().Before(entry.expiresAt) {
+			return fetchResult{}, entry.err.withHeader("X-Negative-Cache", "HIT")
+		}
+		negativeCache.Delete(negativeKey)
+	}
+
+	result, reqErr, cacheable := fetchUpstream(ctx, rawURL, validators)
+	if reqErr == nil {
+		return result, nil
+	}
+
+	if ttl := envDuration("NEGATIVE_CACHE_TTL_MS", 30*time.Second); cacheable && ttl > 0 {
+		negativeCache.Store(negativeKey, negativeCacheEntry{err: reqErr, expiresAt: time.Now().Add(ttl)})
+		if negativeCacheStores.Add(1)%256 == 0 {
+			sweepNegativeCache()
+		}
+		return fetchResult{}, reqErr.withHeader("X-Negative-Cache", "MISS")
+	}
+
+	return fetchResult{}, reqErr
+}
+
+func sweepNegativeCache() {
+	now := time.Now()
+	negativeCache.Range(func(key, val any) bool {
+		if now.After(val.(negativeCacheEntry).expiresAt) {
+			negativeCache.Delete(key)
+		}
+		return true
+	})
+}
+
+func fetchUpstream(ctx context.Context, rawURL string, validators urlValidators) (fetchResult, *requestError, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fetchResult{}, &requestError{status: http.StatusBadRequest, message: "Invalid URL", details: err.Error()}, false
+	}
+	if err := checkFetchURL(req.URL); err != nil {
+		return fetchResult{}, &requestError{status: http.StatusForbidden, message: "URL not allowed", details: err.Error()}, false
+	}
+	if validators.etag != "" {
+		req.Header.Set("If-None-Match", validators.etag)
+	}
+	if validators.lastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.lastModified)
+	}
+
+	limiter := hostLimiter(req.URL.Host)
+	if !limiter.acquire(timeUntilDeadline(ctx)) {
+		return fetchResult{}, hostBusyError(req.URL.Host), false
+	}
+	defer limiter.release()
+
+	started := time.Now()
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fetchResult{}, timeoutError(), false
+		}
+		return fetchResult{}, &requestError{status: http.StatusBadRequest, message: "Failed to fetch image from URL", details: err.Error()}, true
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && (validators.etag != "" || validators.lastModified != "") {
+		return fetchResult{
+			finalURL:    resp.Request.URL.String(),
+			status:      resp.StatusCode,
+			duration:    time.Since(started),
+			notModified: true,
+		}, nil, false
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fetchResult{}, &requestError{status: http.StatusBadRequest, message: "Failed to fetch image from URL", details: fmt.Sprintf("unexpected status %d", resp.StatusCode)}, true
+	}
+
+	limit := maxUploadBytes()
+	skinBytes, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fetchResult{}, timeoutError(), false
+		}
+		return fetchResult{}, &requestError{status: http.StatusInternalServerError, message: "Failed to read image from URL", details: err.Error()}, false
+	}
+	if int64(len(skinBytes)) > limit {
+		return fetchResult{}, uploadTooLargeError(limit), false
+	}
+
+	return fetchResult{
+		body:         skinBytes,
+		finalURL:     resp.Request.URL.String(),
+		status:       resp.StatusCode,
+		duration:     time.Since(started),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, nil, false
+}
+
+// hostLimiter returns the FIFO limiter bounding concurrent fetches to one
+// upstream host (FETCH_HOST_CONCURRENCY, default 8), so a burst for one
+// CDN can't get us throttled by it.
+func hostLimiter(host string) *concurrencyLimiter {
+	if val, ok := hostLimiters.Load(host); ok {
+		return val.(*concurrencyLimiter)
+	}
+
+	limit, err := strconv.Atoi(getEnvDefault("FETCH_HOST_CONCURRENCY", "8"))
+	if err != nil {
+		limit = 8
+	}
+	queue, err := strconv.Atoi(getEnvDefault("FETCH_HOST_QUEUE_SIZE", "256"))
+	if err != nil {
+		queue = 256
+	}
+
+	val, _ := hostLimiters.LoadOrStore(host, newConcurrencyLimiter(limit, queue))
+	return val.(*concurrencyLimiter)
+}
+
+func timeUntilDeadline(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return requestTimeout()
+}
+
+func hostBusyError(host string) *requestError {
+	return &requestError{
+		status:  http.StatusServiceUnavailable,
+		message: "Upstream host busy",
+		details: "too many concurrent fetches to " + host + ", retry later",
+		header:  http.Header{"Retry-After": {"1"}},
+	}
+}
+
+func timeoutError() *requestError {
+	return &requestError{status: http.StatusGatewayTimeout, message: "Request timed out", details: "the request exceeded its time budget"}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+)
+
+// uploadFormats maps each accepted MIME type to a check of its magic
+// bytes. Only PNG is accepted unless convert=true.
+var uploadFormats = map[string]func(data []byte) bool{
+	"image/png": func(data []byte) bool { return bytes.HasPrefix(data, pngSignature) },
+	"image/jpeg": func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff})
+	},
+	"image/gif": func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+	},
+	"image/webp": func(data []byte) bool {
+		return len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP"
+	},
+}
+
+// uploadTypeAliases maps nonstandard types that clients commonly send to
+// the type they mean.
+var uploadTypeAliases = map[string]string{
+	"image/jpg": "image/jpeg",
+}
+
+// checkUploadType rejects uploads whose leading bytes aren't an accepted
+// image format, or that contradict the part's declared Content-Type,
+// before any decoder sees them. A missing or generic declared type is
+// not held against the upload, and parameters such as charset are
+// ignored.
+func checkUploadType(data []byte, declared string, opts hashOptions) *requestError {
+	detected := ""
+	for mimeType, matches := range uploadFormats {
+		if (mimeType == "image/png" || opts.convert) && matches(data) {
+			detected = mimeType
+			break
+		}
+	}
+	if detected == "" {
+		details := "file is not a PNG image"
+		if opts.convert {
+			details = "file is not a PNG, JPEG, GIF or WebP image"
+		}
+		return &requestError{status: http.StatusUnsupportedMediaType, message: "Unsupported file type", details: details}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil || mediaType == "application/octet-stream" {
+		return nil
+	}
+	if alias, ok := uploadTypeAliases[mediaType]; ok {
+		mediaType = alias
+	}
+	if mediaType != detected {
+		return &requestError{status: http.StatusUnsupportedMediaType, message: "Content-Type mismatch", details: "declared " + mediaType + " but file is " + detected}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestCheckUploadTypeDeclaredTypes(t *testing.T) {
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe0}
+	cases := []struct {
+		data     []byte
+		declared string
+		ok       bool
+	}{
+		{pngSignature, "image/png", true},
+		{pngSignature, "image/png; charset=binary", true},
+		{pngSignature, "IMAGE/PNG", true},
+		{pngSignature, "application/octet-stream", true},
+		{pngSignature, "", true},
+		{pngSignature, "image/jpeg", false},
+		{jpeg, "image/jpeg", true},
+		{jpeg, "image/jpg", true},
+		{jpeg, "image/jpg; name=skin.jpg", true},
+		{jpeg, "image/png", false},
+	}
+	for _, c := range cases {
+		reqErr := checkUploadType(c.data, c.declared, hashOptions{convert: true})
+		if (reqErr == nil) != c.ok {
+			t.Errorf("declared %q: got %v, want ok=%v", c.declared, reqErr, c.ok)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// mirrorInvariantHash hashes whichever of the canonical pixel buffer and
+// its horizontally mirrored copy sorts first, so a skin and its mirror
+// image share the hash.
+func mirrorInvariantHash(img *image.NRGBA) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	pixels := canonicalPixels(img)
+	mirrored := make([]byte, len(pixels))
+	for y := range height {
+		row := pixels[y*width*4 : (y+1)*width*4]
+		out := mirrored[y*width*4 : (y+1)*width*4]
+		for x := range width {
+			copy(out[x*4:x*4+4], row[(width-1-x)*4:(width-x)*4])
+		}
+	}
+
+	if bytes.Compare(mirrored, pixels) < 0 {
+		pixels = mirrored
+	}
+	return hashBuffer(append(dimensionHeader(width, height), pixels...))
+}
+
+// hueInvariantHash hashes each pixel's value (max channel), chroma
+// (max - min) and alpha. A hue rotation permutes and blends the colour
+// channels but keeps max and min, so recoloured copies hash the same.
+func hueInvariantHash(img *image.NRGBA) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	pixels := canonicalPixels(img)
+	out := make([]byte, 0, width*height*3)
+	for i := 0; i < len(pixels); i += 4 {
+		r, g, b := pixels[i], pixels[i+1], pixels[i+2]
+		high, low := max(r, g, b), min(r, g, b)
+		out = append(out, high, high-low, pixels[i+3])
+	}
+	return hashBuffer(append(dimensionHeader(width, height), out...))
+}
+
+// canonicalPixels returns img's pixels row by row with the colour of fully
+// transparent pixels zeroed, as the alpha-normalized hash sees them.
+func canonicalPixels(img *image.NRGBA) []byte {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	pixels := make([]byte, 0, width*height*4)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		i := img.PixOffset(bounds.Min.X, y)
+		pixels = append(pixels, img.Pix[i:i+width*4]...)
+	}
+	for i := 0; i < len(pixels); i += 4 {
+		if pixels[i+3] == 0 {
+			pixels[i], pixels[i+1], pixels[i+2] = 0, 0, 0
+		}
+	}
+	return pixels
+}
+
+func dimensionHeader(width int, height int) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:], uint32(width))
+	binary.BigEndian.PutUint32(header[4:], uint32(height))
+	return header
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fuzzImagePixels lowers MAX_IMAGE_PIXELS while fuzzing, so inputs that
+// pass the guard stay cheap to decode and those that declare huge
+// canvases exercise checkImageSize instead of being skipped.
+const fuzzImagePixels = 1 << 20
+
+func limitFuzzImagePixels(f *testing.F) {
+	f.Helper()
+	previous := getEnvDefault("MAX_IMAGE_PIXELS", "")
+	setEnv("MAX_IMAGE_PIXELS", strconv.Itoa(fuzzImagePixels))
+	f.Cleanup(func() { setEnv("MAX_IMAGE_PIXELS", previous) })
+}
+
+func addConformanceSeeds(f *testing.F) {
+	f.Helper()
+	files, err := filepath.Glob("conformance/*.png")
+	if err != nil || len(files) == 0 {
+		f.Fatalf("no conformance fixtures: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add(headerOnlyPNG(20000, 20000))
+}
+
+func FuzzComputeHashes(f *testing.F) {
+	addConformanceSeeds(f)
+	limitFuzzImagePixels(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		opts := hashOptions{convert: true, downscale: true, analysis: true}
+		first, err := computeHashes(data, opts)
+		if errors.Is(err, errImageTooLarge) {
+			config, _, _ := image.DecodeConfig(bytes.NewReader(data))
+			if config.Width*config.Height <= fuzzImagePixels {
+				t.Fatalf("%dx%d rejected as too large", config.Width, config.Height)
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+		if len(first.AlphaNormalized) != 64 || first.AlphaNormalizedCompact != first.AlphaNormalized[:16] {
+			t.Fatalf("malformed alpha_normalized_hash %q", first.AlphaNormalized)
+		}
+
+		second, err := computeHashes(data, opts)
+		if err != nil {
+			t.Fatalf("second run failed: %v", err)
+		}
+		if first.AlphaNormalized != second.AlphaNormalized || first.Standard != second.Standard {
+			t.Fatal("hashes are not deterministic")
+		}
+	})
+}
+
+func FuzzAPNGFrameHashes(f *testing.F) {
+	addConformanceSeeds(f)
+	limitFuzzImagePixels(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		chunks, err := readPNGChunks(data)
+		if err != nil {
+			return
+		}
+		for _, chunk := range chunks {
+			if len(chunk.kind) != 4 {
+				t.Fatalf("chunk type %q is not 4 bytes", chunk.kind)
+			}
+		}
+
+		// computeHashes runs this guard before it gets to the frames.
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || checkImageSize(config) != nil {
+			return
+		}
+		hashes, err := apngFrameHashes(data)
+		if err != nil {
+			return
+		}
+		for i, hash := range hashes {
+			if len(hash) != 64 {
+				t.Fatalf("frame %d hash %q is not 64 characters", i, hash)
+			}
+		}
+	})
+}
@@ -3,6 +3,9 @@ module namemc-hash-api
 go 1.24
 
 require (
-	github.com/disintegration/imaging v1.6.2 // indirect
-	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8 // indirect
+	github.com/disintegration/imaging v1.6.2
+	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
+	golang.org/x/net v0.40.0
 )
+
+require golang.org/x/text v0.25.0 // indirect
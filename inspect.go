@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"slices"
+)
+
+const maxInspectTextBytes = 64 << 10
+
+type PNGInfo struct {
+	Chunks   []string          `json:"chunks"`
+	Text     map[string]string `json:"text,omitempty"`
+	Software string            `json:"software,omitempty"`
+	HasGamma bool              `json:"has_gama"`
+	HasICCP  bool              `json:"has_iccp"`
+	ICCPName string            `json:"iccp_name,omitempty"`
+}
+
+type InspectResponse struct {
+	HashResponse
+	PNG *PNGInfo `json:"png"`
+}
+
+// handleInspect hashes an image like /hash and also reports the PNG's
+// chunk layout and embedded text metadata. Non-PNG inputs (convert=true)
+// report "png": null.
+func handleInspect(w http.ResponseWriter, r *http.Request) {
+	if reqErr := validateHashRequest(r); reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	opts := parseHashOptions(r)
+
+	var data, upload []byte
+	var hashes HashResponse
+	var reqErr *requestError
+	rawURL := r.URL.Query().Get("url")
+	if rawURL != "" {
+		var result fetchResult
+		result, reqErr = fetchURL(r.Context(), rawURL)
+		data = result.body
+	} else {
+		data, reqErr = readUploadedFile(r, opts)
+		if reqErr != nil {
+			reqErr.write(w)
+			return
+		}
+		upload = data
+	}
+
+	if reqErr == nil {
+		hashes, _, reqErr = hashContent(data, opts)
+	}
+	auditHashRequest(r, "inspect", rawURL, upload, hashes, reqErr)
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	resp := InspectResponse{HashResponse: hashes}
+	if hashes.ConvertedFrom == "" {
+		info, err := inspectPNG(data)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to inspect PNG", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		resp.PNG = &info
+	}
+	writeHashResponse(w, r, resp)
+}
+
+func inspectPNG(data []byte) (PNGInfo, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return PNGInfo{}, err
+	}
+
+	info := PNGInfo{Chunks: make([]string, 0, len(chunks))}
+	for _, chunk := range chunks {
+		info.Chunks = append(info.Chunks, chunk.kind)
+
+		switch chunk.kind {
+		case "gAMA":
+			info.HasGamma = true
+		case "iCCP":
+			info.HasICCP = true
+			name, _, _ := bytes.Cut(chunk.data, []byte{0})
+			info.ICCPName = string(name)
+		case "tEXt", "zTXt", "iTXt":
+			key, value, ok := pngTextChunk(chunk)
+			if !ok {
+				continue
+			}
+			if info.Text == nil {
+				info.Text = make(map[string]string)
+			}
+			info.Text[key] = value
+			if key == "Software" {
+				info.Software = value
+			}
+		}
+	}
+	// Runs of IDAT (or fdAT) chunks are listed once.
+	info.Chunks = slices.Compact(info.Chunks)
+	return info, nil
+}
+
+// pngTextChunk decodes the keyword and text of a tEXt, zTXt or iTXt chunk.
+// Compressed text is inflated up to maxInspectTextBytes.
+func pngTextChunk(chunk pngChunk) (string, string, bool) {
+	key, rest, ok := bytes.Cut(chunk.data, []byte{0})
+	if !ok {
+		return "", "", false
+	}
+
+	compressed := false
+	switch chunk.kind {
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		rest, compressed = rest[1:], true
+	case "iTXt":
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed = rest[0] == 1
+		// Skip the compression method, language tag and translated keyword.
+		_, rest, ok = bytes.Cut(rest[2:], []byte{0})
+		if ok {
+			_, rest, ok = bytes.Cut(rest, []byte{0})
+		}
+		if !ok {
+			return "", "", false
+		}
+	}
+
+	if !compressed {
+		return string(key), string(rest), true
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return "", "", false
+	}
+	defer reader.Close()
+
+	text, err := io.ReadAll(io.LimitReader(reader, maxInspectTextBytes))
+	if err != nil {
+		return "", "", false
+	}
+	return string(key), string(text), true
+}
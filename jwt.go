@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jwtLeeway          = 30 * time.Second
+	jwksRefreshMinWait = time.Minute
+	jwksMaxAge         = 10 * time.Minute
+)
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+}
+
+// jwtAudience accepts both the single-string and array forms of "aud".
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+type jwtConfig struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	jwksURL   string
+	issuer    string
+	audience  string
+}
+
+type contextKey string
+
+const subjectContextKey contextKey = "subject"
+
+var (
+	jwtSettings     *jwtConfig
+	jwtSettingsOnce sync.Once
+
+	jwksKeys      map[string]*rsa.PublicKey
+	jwksFetchedAt time.Time
+	// jwksRefreshing is closed when the running refresh finishes, and nil
+	// when none is running.
+	jwksRefreshing chan struct{}
+	jwksMu         sync.Mutex
+
+	jwksClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+func loadJWTConfig() *jwtConfig {
+	jwtSettingsOnce.Do(func() {
+		config := &jwtConfig{
+			secret:   []byte(getEnvDefault("JWT_HS256_SECRET", "")),
+			jwksURL:  getEnvDefault("JWT_JWKS_URL", ""),
+			issuer:   getEnvDefault("JWT_ISSUER", ""),
+			audience: getEnvDefault("JWT_AUDIENCE", ""),
+		}
+
+		if path := getEnvDefault("JWT_PUBLIC_KEY_FILE", ""); path != "" {
+			key, err := readRSAPublicKey(path)
+			if err != nil {
+				log.Fatal("Failed to load JWT public key:", err)
+			}
+			config.publicKey = key
+		}
+
+		if len(config.secret) > 0 || config.publicKey != nil || config.jwksURL != "" {
+			jwtSettings = config
+		}
+	})
+	return jwtSettings
+}
+
+// authMiddleware requires a valid bearer JWT when any JWT verification key
+// is configured, and passes requests through untouched otherwise. With a
+// CAPTCHA provider configured, requests without a bearer token are let
+// through only with a valid CAPTCHA token (public demo mode).
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := loadJWTConfig()
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		hasToken := ok && token != ""
+
+		if captchaEnabled() && (config == nil || !hasToken) {
+			if err := verifyCaptcha(r); err != nil {
+				writeUnauthorized(w, err.Error())
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		if config == nil {
+			next(w, r)
+			return
+		}
+
+		if !hasToken {
+			writeUnauthorized(w, "missing bearer token")
+			return
+		}
+
+		claims, err := verifyJWT(config, token)
+		if err != nil {
+			writeUnauthorized(w, err.Error())
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), subjectContextKey, claims.Subject)))
+	}
+}
+
+func writeUnauthorized(w http.ResponseWriter, details string) {
+	reqErr := &requestError{status: http.StatusUnauthorized, message: "Unauthorized", details: details}
+	reqErr.withHeader("WWW-Authenticate", `Bearer realm="namemc-hash-api"`).write(w)
+}
+
+func requestSubject(r *http.Request) string {
+	subject, _ := r.Context().Value(subjectContextKey).(string)
+	return subject
+}
+
+func verifyJWT(config *jwtConfig, token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return jwtClaims{}, fmt.Errorf("invalid header: %v", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, fmt.Errorf("invalid signature encoding: %v", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Algorithm {
+	case "HS256":
+		if len(config.secret) == 0 {
+			return jwtClaims{}, errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, config.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return jwtClaims{}, errors.New("invalid signature")
+		}
+	case "RS256":
+		key, err := rsaKeyFor(config, header.KeyID)
+		if err != nil {
+			return jwtClaims{}, err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return jwtClaims{}, errors.New("invalid signature")
+		}
+	default:
+		return jwtClaims{}, fmt.Errorf("unsupported algorithm %q", header.Algorithm)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return jwtClaims{}, fmt.Errorf("invalid claims: %v", err)
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == nil {
+		return jwtClaims{}, errors.New("token has no exp claim")
+	}
+	if now.After(unixFloat(*claims.ExpiresAt).Add(jwtLeeway)) {
+		return jwtClaims{}, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(unixFloat(*claims.NotBefore)) {
+		return jwtClaims{}, errors.New("token not yet valid")
+	}
+	if config.issuer != "" && claims.Issuer != config.issuer {
+		return jwtClaims{}, errors.New("unexpected issuer")
+	}
+	if config.audience != "" && !slices.Contains(claims.Audience, config.audience) {
+		return jwtClaims{}, errors.New("unexpected audience")
+	}
+
+	return claims, nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func unixFloat(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func rsaKeyFor(config *jwtConfig, keyID string) (*rsa.PublicKey, error) {
+	if config.jwksURL == "" {
+		if config.publicKey == nil {
+			return nil, errors.New("RS256 tokens are not accepted")
+		}
+		return config.publicKey, nil
+	}
+
+	jwksMu.Lock()
+	key, ok := jwksKeys[keyID]
+	// Unknown kids trigger a refresh (keys may have rotated), but not more
+	// than once per jwksRefreshMinWait so bogus tokens can't hammer the IdP.
+	if time.Since(jwksFetchedAt) > jwksMaxAge || (!ok && time.Since(jwksFetchedAt) > jwksRefreshMinWait) {
+		refreshJWKS(config.jwksURL)
+	}
+	refreshing := jwksRefreshing
+	jwksMu.Unlock()
+
+	// A known key keeps working while a refresh runs; only unknown kids
+	// wait for it.
+	if ok {
+		return key, nil
+	}
+	if refreshing != nil {
+		<-refreshing
+		jwksMu.Lock()
+		key, ok = jwksKeys[keyID]
+		jwksMu.Unlock()
+		if ok {
+			return key, nil
+		}
+	}
+	if config.publicKey != nil {
+		return config.publicKey, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", keyID)
+}
+
+// refreshJWKS starts fetching the key set unless a fetch is already
+// running. The caller must hold jwksMu; the fetch itself runs without it,
+// and the old key set stays in use until it succeeds.
+func refreshJWKS(jwksURL string) {
+	if jwksRefreshing != nil {
+		return
+	}
+	done := make(chan struct{})
+	jwksRefreshing = done
+	jwksFetchedAt = time.Now()
+
+	go func() {
+		keys, err := fetchJWKS(jwksURL)
+		jwksMu.Lock()
+		if err != nil {
+			logWarnf("Failed to refresh JWKS: %v", err)
+		} else {
+			jwksKeys = keys
+		}
+		jwksRefreshing = nil
+		jwksMu.Unlock()
+		close(done)
+	}()
+}
+
+func fetchJWKS(jwksURL string) (map[string]*rsa.PublicKey, error) {
+	resp, err := jwksClient.Get(jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func readRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not RSA")
+	}
+	return key, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func signHS256(t *testing.T, secret []byte, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWTRequiresExp(t *testing.T) {
+	config := &jwtConfig{secret: []byte("s3cret")}
+
+	if _, err := verifyJWT(config, signHS256(t, config.secret, map[string]any{"sub": "a"})); err == nil {
+		t.Error("token without exp was accepted")
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	if _, err := verifyJWT(config, signHS256(t, config.secret, map[string]any{"sub": "a", "exp": exp})); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+}
+
+func TestWriteUnauthorizedEscapesDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeUnauthorized(rec, `unsupported algorithm "x\y"`)
+
+	var body struct {
+		Details string `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if body.Details != `unsupported algorithm "x\y"` || rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("got %d %q %v", rec.Code, body.Details, rec.Header())
+	}
+}
+
+func TestRSAKeyForFetchesJWKSOnce(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer server.Close()
+
+	jwksMu.Lock()
+	jwksKeys, jwksFetchedAt = nil, time.Time{}
+	jwksMu.Unlock()
+
+	config := &jwtConfig{jwksURL: server.URL}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := rsaKeyFor(config, "k1")
+			if err != nil || got.N.Cmp(key.N) != 0 {
+				t.Errorf("rsaKeyFor = %v, %v", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// concurrencyLimiter bounds in-flight work and queues excess callers in
+// FIFO order. Once the queue is full, or a caller has waited longer than
+// its timeout, acquire fails and the caller is counted as shed.
+type concurrencyLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	maxQueue int
+	inFlight int
+	waiters  []chan struct{}
+	shed     int64
+}
+
+type limiterStats struct {
+	Limit      int   `json:"limit"`
+	InFlight   int   `json:"in_flight"`
+	QueueDepth int   `json:"queue_depth"`
+	ShedTotal  int64 `json:"shed_total"`
+}
+
+var hashLimiter *concurrencyLimiter
+
+func newConcurrencyLimiter(limit int, maxQueue int) *concurrencyLimiter {
+	return &concurrencyLimiter{limit: limit, maxQueue: maxQueue}
+}
+
+func initHashLimiter() {
+	limit, _ := strconv.Atoi(getEnvDefault("MAX_CONCURRENT_HASHES", "0"))
+	queue, _ := strconv.Atoi(getEnvDefault("HASH_QUEUE_SIZE", "64"))
+	hashLimiter = newConcurrencyLimiter(limit, queue)
+}
+
+func hashQueueTimeout() time.Duration {
+	ms, err := strconv.Atoi(getEnvDefault("HASH_QUEUE_TIMEOUT_MS", "1000"))
+	if err != nil {
+		ms = 1000
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (l *concurrencyLimiter) acquire(timeout time.Duration) bool {
+	l.mu.Lock()
+	if l.limit <= 0 || (l.inFlight < l.limit && len(l.waiters) == 0) {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+
+	if len(l.waiters) >= l.maxQueue {
+		l.shed++
+		l.mu.Unlock()
+		return false
+	}
+
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := slices.Index(l.waiters, ready); i >= 0 {
+		l.waiters = slices.Delete(l.waiters, i, i+1)
+		l.shed++
+		return false
+	}
+
+	// release handed us a slot between the timeout firing and taking the lock.
+	return true
+}
+
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.grant()
+}
+
+func (l *concurrencyLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.grant()
+}
+
+func (l *concurrencyLimiter) setMaxQueue(maxQueue int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxQueue = maxQueue
+}
+
+func (l *concurrencyLimiter) grant() {
+	for len(l.waiters) > 0 && (l.limit <= 0 || l.inFlight < l.limit) {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+	}
+}
+
+func (l *concurrencyLimiter) stats() limiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return limiterStats{
+		Limit:      l.limit,
+		InFlight:   l.inFlight,
+		QueueDepth: len(l.waiters),
+		ShedTotal:  l.shed,
+	}
+}
+
+func overloadedError() *requestError {
+	return &requestError{
+		status:  http.StatusServiceUnavailable,
+		message: "Server overloaded",
+		details: "too many hash computations in flight, retry later",
+		header:  http.Header{"Retry-After": {"1"}},
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "log"
+
+// Log levels in increasing severity. LOG_LEVEL (default info) names the
+// lowest level that is printed.
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+func logLevel() int {
+	level, ok := logLevels[getEnvDefault("LOG_LEVEL", "info")]
+	if !ok {
+		return levelInfo
+	}
+	return level
+}
+
+func logf(level int, format string, args ...any) {
+	if level >= logLevel() {
+		log.Printf(format, args...)
+	}
+}
+
+func logDebugf(format string, args ...any) { logf(levelDebug, format, args...) }
+func logInfof(format string, args ...any)  { logf(levelInfo, format, args...) }
+func logWarnf(format string, args ...any)  { logf(levelWarn, format, args...) }
+func logErrorf(format string, args ...any) { logf(levelError, format, args...) }
@@ -2,36 +2,200 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
-	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
-	"image/draw"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
 
 	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
 )
 
 type HashResponse struct {
-	Standard               string `json:"standard_hash"`
-	AlphaNormalized        string `json:"alpha_normalized_hash"`
-	AlphaNormalizedCompact string `json:"alpha_normalized_compact"`
+	Standard               string   `json:"standard_hash,omitempty"`
+	StrippedStandard       string   `json:"stripped_standard_hash,omitempty"`
+	AlphaNormalized        string   `json:"alpha_normalized_hash"`
+	AlphaNormalizedCompact string   `json:"alpha_normalized_compact"`
+	ConvertedFrom          string   `json:"converted_from,omitempty"`
+	Frames                 []string `json:"frames,omitempty"`
+	FramesHash             string   `json:"frames_hash,omitempty"`
+	DownscaledHash         string   `json:"downscaled_hash,omitempty"`
+	IsDefaultSkin          *bool    `json:"is_default_skin,omitempty"`
+	DefaultSkin            string   `json:"default_skin,omitempty"`
+	HasNoiseRegions        *bool    `json:"has_noise_regions,omitempty"`
+	MirrorInvariant        string   `json:"mirror_invariant_hash,omitempty"`
+	HueInvariant           string   `json:"hue_invariant_hash,omitempty"`
+	Tags                   []Tag    `json:"tags,omitempty"`
+	Blocked                bool     `json:"blocked,omitempty"`
 }
 
-var cache sync.Map
+// hashOptions are the per-request switches that change what is accepted
+// or computed for an image.
+type hashOptions struct {
+	convert   bool
+	downscale bool
+	analysis  bool
+	// batch skips cache (and peer) lookups for content the known-hash
+	// filter has definitely never seen.
+	batch bool
+	// skipStandard (skip=standard) drops the standard hashes from the
+	// response and skips the PNG re-encode check that goes with them.
+	skipStandard bool
+}
+
+var errNotPNG = errors.New("only PNG images are supported")
+
+type SourceInfo struct {
+	RequestedURL    string     `json:"requested_url,omitempty"`
+	NormalizedURL   string     `json:"normalized_url,omitempty"`
+	FinalURL        string     `json:"final_url,omitempty"`
+	UpstreamStatus  int        `json:"upstream_status,omitempty"`
+	ContentLength   int        `json:"content_length"`
+	FetchDurationMs float64    `json:"fetch_duration_ms,omitempty"`
+	FetchedAt       *time.Time `json:"fetched_at,omitempty"`
+	Cached          bool       `json:"cached"`
+}
+
+type HashWithSource struct {
+	HashResponse
+	Source *SourceInfo `json:"source"`
+}
 
 func main() {
+	snapshotFlag := flag.String("cache-snapshot", "", "NDJSON cache snapshot imported at startup and exported on shutdown (overrides CACHE_SNAPSHOT_FILE)")
+	flag.Parse()
+
 	loadEnvironment()
-	http.HandleFunc("/hash", recoverMiddleware(handleHash))
-	log.Printf("Server running on http://%s:%s", getEnv("HOST"), getEnv("PORT"))
-	log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%s", getEnv("HOST"), getEnv("PORT")), nil))
+	loadVaultSecrets()
+	validateConfig()
+	loadFeatureFlags()
+	loadJWTConfig()
+	loadDefaultSkins()
+	loadNameMCMappings()
+	loadTags()
+	initHashLimiter()
+	initPeers()
+	startScheduler()
+	startWebhookDelivery()
+
+	snapshotPath := *snapshotFlag
+	if snapshotPath == "" {
+		snapshotPath = getEnvDefault("CACHE_SNAPSHOT_FILE", "")
+	}
+	if snapshotPath != "" {
+		importCacheSnapshotFile(snapshotPath)
+	}
+	startWarmup()
+	startStatsD()
+	startEventSink()
+	watchConfigReload()
+
+	// The public listener gets its own mux rather than http.DefaultServeMux
+	// so nothing registered globally (net/http/pprof) can leak onto it.
+	mux := http.NewServeMux()
+	adminMux := mux
+	if adminListenerEnabled() {
+		adminMux = http.NewServeMux()
+		registerPprof(adminMux)
+	}
+
+	mux.HandleFunc("GET /{$}", handleIndex)
+	mux.HandleFunc("GET /.well-known/jwks.json", handleSigningKeys)
+	mux.HandleFunc("/hash", recoverMiddleware(authMiddleware(timeoutMiddleware(handleHash))))
+	mux.HandleFunc("POST /hash/batch", recoverMiddleware(authMiddleware(handleHashBatch)))
+	mux.HandleFunc("GET /hash/namemc", recoverMiddleware(authMiddleware(timeoutMiddleware(handleHashNameMC))))
+	mux.HandleFunc("GET /namemc/mapping", authMiddleware(handleNameMCMapping))
+	mux.HandleFunc("/inspect", recoverMiddleware(authMiddleware(timeoutMiddleware(handleInspect))))
+	mux.HandleFunc("POST /compare/matrix", recoverMiddleware(authMiddleware(timeoutMiddleware(handleCompareMatrix))))
+	mux.HandleFunc("POST /rpc", recoverMiddleware(authMiddleware(timeoutMiddleware(handleRPC))))
+	mux.HandleFunc("/ws", authMiddleware(webSocketHandler.ServeHTTP))
+	adminMux.HandleFunc("GET /stats", authMiddleware(handleStats))
+	mux.HandleFunc("GET /conformance", recoverMiddleware(authMiddleware(handleConformance)))
+	mux.HandleFunc("GET /features", recoverMiddleware(authMiddleware(handleFeatures)))
+	mux.HandleFunc("DELETE /sources", recoverMiddleware(authMiddleware(handleDeleteSource)))
+	mux.HandleFunc("GET /tags/{hash}", authMiddleware(handleGetTags))
+	mux.HandleFunc("POST /tags/{hash}", recoverMiddleware(authMiddleware(handleAddTag)))
+	mux.HandleFunc("DELETE /tags/{hash}/{label}", recoverMiddleware(authMiddleware(handleDeleteTag)))
+	mux.HandleFunc("GET /known", authMiddleware(handleKnown))
+	mux.HandleFunc("GET /feed", authMiddleware(handleFeed))
+	mux.HandleFunc("POST /subscriptions", recoverMiddleware(authMiddleware(handleCreateSubscription)))
+	mux.HandleFunc("GET /subscriptions", recoverMiddleware(authMiddleware(handleListSubscriptions)))
+	mux.HandleFunc("DELETE /subscriptions/{id}", recoverMiddleware(authMiddleware(handleDeleteSubscription)))
+	adminMux.HandleFunc("GET /admin", adminMiddleware(handleAdminDashboard))
+	adminMux.HandleFunc("GET /admin/summary", adminMiddleware(handleAdminSummary))
+	adminMux.HandleFunc("GET /admin/config", adminMiddleware(handleGetConfig))
+	adminMux.HandleFunc("PUT /admin/config", recoverMiddleware(adminMiddleware(handlePutConfig)))
+	adminMux.HandleFunc("GET /admin/webhooks", adminMiddleware(handleListWebhooks))
+	adminMux.HandleFunc("POST /admin/webhooks/{id}/retry", recoverMiddleware(adminMiddleware(handleRetryWebhook)))
+	adminMux.HandleFunc("GET /admin/cache/export", adminMiddleware(handleCacheExport))
+	adminMux.HandleFunc("POST /admin/cache/import", recoverMiddleware(adminMiddleware(handleCacheImport)))
+
+	if getEnvDefault("MINESKIN_API_KEY", "") != "" {
+		mux.HandleFunc("POST /mineskin", recoverMiddleware(authMiddleware(handleMineSkinUpload)))
+	}
+	if peers != nil {
+		mux.HandleFunc("/peer/cache", recoverMiddleware(handlePeerCache))
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf("%s:%s", getEnv("HOST"), getEnv("PORT")),
+		Handler:           mux,
+		ReadHeaderTimeout: envDuration("READ_HEADER_TIMEOUT_MS", 5*time.Second),
+		IdleTimeout:       envDuration("IDLE_TIMEOUT_MS", 120*time.Second),
+		Protocols:         serverProtocols("HTTP_PROTOCOLS", "http1"),
+	}
+
+	activated := systemdListeners()
+	listener, err := listen(activated, 0, server.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		logInfof("Server running on http://%s", listener.Addr())
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	var adminServer *http.Server
+	if adminMux != mux {
+		adminServer = startAdminServer(adminMux, activated)
+	}
+	sdNotify("READY=1")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	logInfof("Shutting down")
+	sdNotify("STOPPING=1")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+	if adminServer != nil {
+		adminServer.Shutdown(ctx)
+	}
+
+	if snapshotPath != "" {
+		if err := exportCacheSnapshotFile(snapshotPath); err != nil {
+			logErrorf("Failed to export cache snapshot: %v", err)
+		}
+	}
 }
 
 func recoverMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -45,114 +209,446 @@ func recoverMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+type requestError struct {
+	status  int
+	message string
+	details string
+	header  http.Header
+	fields  []fieldError
+}
+
+func (e *requestError) write(w http.ResponseWriter) {
+	for key, values := range e.header {
+		w.Header()[key] = values
+	}
+
+	body, _ := json.Marshal(struct {
+		Error   string       `json:"error"`
+		Details string       `json:"details"`
+		Fields  []fieldError `json:"fields,omitempty"`
+	}{e.message, e.details, e.fields})
+	http.Error(w, string(body), e.status)
+}
+
+func (e *requestError) withHeader(key string, value string) *requestError {
+	clone := *e
+	clone.header = e.header.Clone()
+	if clone.header == nil {
+		clone.header = make(http.Header)
+	}
+	clone.header.Set(key, value)
+	return &clone
+}
+
+// timeoutMiddleware bounds the whole request, including reading an
+// uploaded body, by REQUEST_TIMEOUT_MS. Callers can ask for a shorter
+// budget with X-Request-Deadline-Ms; longer ones are capped.
+func timeoutMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout := requestTimeout()
+		if deadline, ok, reqErr := clientDeadline(r); reqErr != nil {
+			reqErr.write(w)
+			return
+		} else if ok {
+			timeout = min(timeout, deadline)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		deadline, _ := ctx.Deadline()
+		http.NewResponseController(w).SetReadDeadline(deadline)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// clientDeadline parses X-Request-Deadline-Ms and reports whether it was
+// given.
+func clientDeadline(r *http.Request) (time.Duration, bool, *requestError) {
+	header := r.Header.Get("X-Request-Deadline-Ms")
+	if header == "" {
+		return 0, false, nil
+	}
+	ms, err := strconv.Atoi(header)
+	if err != nil || ms <= 0 {
+		return 0, false, &requestError{status: http.StatusBadRequest, message: "Invalid X-Request-Deadline-Ms", details: "must be a positive number of milliseconds"}
+	}
+	return time.Duration(ms) * time.Millisecond, true, nil
+}
+
 func handleHash(w http.ResponseWriter, r *http.Request) {
+	if reqErr := validateHashRequest(r); reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	var hashes HashResponse
+	var source SourceInfo
+	var reqErr *requestError
 	var skinBytes []byte
-	var err error
-	var cacheKey string
 
-	url := r.URL.Query().Get("url")
-	if url != "" {
-		cleanedURL, err := normalizeURL(url)
-		if err != nil {
-			http.Error(w, `{"error": "Invalid URL", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+	started := time.Now()
+	opts := parseHashOptions(r)
+	rawURL := r.URL.Query().Get("url")
+	if rawURL == "" && r.URL.Query().Get("source") != "" {
+		rawURL, reqErr = resolveSource(r.Context(), r.URL.Query().Get("source"))
+		if reqErr != nil {
+			reqErr.write(w)
 			return
 		}
-
-		cacheKey = fmt.Sprintf("url:%s", cleanedURL)
-		if val, ok := cache.Load(cacheKey); ok {
-			writeJSON(w, val)
+	}
+	contentSHA := strings.ToLower(r.URL.Query().Get("content_sha256"))
+	switch {
+	case rawURL != "":
+		hashes, source, reqErr = hashURL(r.Context(), rawURL, opts)
+	case contentSHA != "":
+		hashes, source, reqErr = hashKnownContent(contentSHA, opts)
+	default:
+		skinBytes, reqErr = readUploadedFile(r, opts)
+		if reqErr != nil {
+			reqErr.write(w)
 			return
 		}
 
-		resp, err := http.Get(url)
-		if err != nil || resp.StatusCode != 200 {
-			http.Error(w, `{"error": "Failed to fetch image from URL", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
-			return
+		hashes, source, reqErr = hashUpload(skinBytes, opts)
+	}
+
+	auditHashRequest(r, "http", rawURL, skinBytes, hashes, reqErr)
+	emitHashEvent("http", rawURL, hashes, source, started, reqErr)
+	trackHashRequest(r, "http", rawURL, reqErr)
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	setCacheHeaders(w, rawURL != "", source)
+	w.Header().Set("X-Skin-Hash-Alpha", hashes.AlphaNormalized)
+	if hashes.Standard != "" {
+		w.Header().Set("X-Skin-Hash-Standard", hashes.Standard)
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.URL.Query().Get("include_source") == "true" {
+		writeHashResponse(w, r, HashWithSource{HashResponse: hashes, Source: &source})
+		return
+	}
+	writeHashResponse(w, r, hashes)
+}
+
+// readUploadedFile reads the "file" multipart field. The body is capped
+// at MAX_UPLOAD_BYTES (plus room for the multipart framing), at most
+// MULTIPART_MEMORY_BYTES of it is buffered in memory with the rest
+// spilling to temporary files, and the file itself is read through a
+// limited reader, so large concurrent uploads can't exhaust the heap.
+func readUploadedFile(r *http.Request, opts hashOptions) ([]byte, *requestError) {
+	limit := maxUploadBytes()
+	r.Body = http.MaxBytesReader(nil, r.Body, limit+multipartOverheadBytes)
+
+	err := r.ParseMultipartForm(multipartMemoryBytes())
+	if err != nil && r.Context().Err() != nil {
+		return nil, timeoutError()
+	}
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		return nil, uploadTooLargeError(limit)
+	}
+	if err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: "Failed to get uploaded file", details: err.Error()}
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: "Failed to get uploaded file", details: err.Error()}
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil && r.Context().Err() != nil {
+		return nil, timeoutError()
+	}
+	if err != nil {
+		return nil, &requestError{status: http.StatusInternalServerError, message: "Failed to read uploaded file", details: err.Error()}
+	}
+	if int64(len(data)) > limit {
+		return nil, uploadTooLargeError(limit)
+	}
+
+	if reqErr := checkUploadType(data, header.Header.Get("Content-Type"), opts); reqErr != nil {
+		return nil, reqErr
+	}
+	return data, nil
+}
+
+// parseHashOptions reads convert=true, which lets JPEG, GIF and WebP
+// inputs through by hashing their decoded pixels like a PNG's,
+// downscale=true, which adds the 64px-wide hash of HD skins, and
+// analysis=true, which adds the mirror- and hue-invariant hashes.
+func parseHashOptions(r *http.Request) hashOptions {
+	query := r.URL.Query()
+	return hashOptions{
+		convert:   query.Get("convert") == "true",
+		downscale: query.Get("downscale") == "true",
+		analysis:  query.Get("analysis") == "true",
+
+		skipStandard: slices.Contains(strings.Split(query.Get("skip"), ","), "standard"),
+	}
+}
+
+// URL entries map url:<normalized url> to the content SHA-256 of what the
+// URL served, and content entries map sha256:<hex> to the HashResponse.
+// URLs serving identical bytes therefore share one computation.
+func hashURL(ctx context.Context, rawURL string, opts hashOptions) (HashResponse, SourceInfo, *requestError) {
+	cleanedURL, err := normalizeURL(rawURL)
+	if err != nil {
+		return HashResponse{}, SourceInfo{}, &requestError{status: http.StatusBadRequest, message: "Invalid URL", details: err.Error()}
+	}
+
+	if contentSHA, ok := lookupURLContent(cleanedURL); ok {
+		if hashes, ok := lookupContent(contentSHA); ok {
+			hashes, reqErr := applyHashOptions(hashes, opts)
+			if reqErr != nil {
+				return HashResponse{}, SourceInfo{}, reqErr
+			}
+			maybeRevalidate(cleanedURL, rawURL)
+			source := lastURLSource(cleanedURL)
+			source.RequestedURL = rawURL
+			source.NormalizedURL = cleanedURL
+			source.Cached = true
+			return hashes, source, nil
 		}
-		defer resp.Body.Close()
+	}
 
-		skinBytes, err = io.ReadAll(resp.Body)
-		if err != nil {
-			http.Error(w, `{"error": "Failed to read image from URL", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
-			return
+	result, reqErr := fetchURL(ctx, rawURL)
+	if reqErr != nil {
+		return HashResponse{}, SourceInfo{}, reqErr
+	}
+
+	hashes, contentSHA, reqErr := hashContent(result.body, opts)
+	if reqErr != nil {
+		return HashResponse{}, SourceInfo{}, reqErr
+	}
+
+	source := newSourceInfo(rawURL, cleanedURL, result)
+	storeURLContent(cleanedURL, contentSHA)
+	markURLFetched(cleanedURL, source, result)
+	return hashes, source, nil
+}
+
+func newSourceInfo(rawURL string, cleanedURL string, result fetchResult) SourceInfo {
+	fetchedAt := time.Now().UTC()
+	return SourceInfo{
+		RequestedURL:    rawURL,
+		NormalizedURL:   cleanedURL,
+		FinalURL:        result.finalURL,
+		UpstreamStatus:  result.status,
+		ContentLength:   len(result.body),
+		FetchDurationMs: float64(result.duration.Microseconds()) / 1000,
+		FetchedAt:       &fetchedAt,
+	}
+}
+
+func hashUpload(skinBytes []byte, opts hashOptions) (HashResponse, SourceInfo, *requestError) {
+	hashes, _, cached, reqErr := lookupOrComputeHashes(skinBytes, opts)
+	return hashes, SourceInfo{ContentLength: len(skinBytes), Cached: cached}, reqErr
+}
+
+// hashKnownContent answers content_sha256= lookups from the cache (local
+// or peer) without an upload. It never computes anything: content that
+// wasn't hashed before is a 404 and has to be uploaded.
+func hashKnownContent(contentSHA string, opts hashOptions) (HashResponse, SourceInfo, *requestError) {
+	hashes, ok := lookupContent(contentSHA)
+	if !ok {
+		return HashResponse{}, SourceInfo{}, &requestError{status: http.StatusNotFound, message: "Content not cached", details: "upload the file to hash it"}
+	}
+	hashes, reqErr := applyHashOptions(hashes, opts)
+	return hashes, SourceInfo{Cached: true}, reqErr
+}
+
+func hashContent(skinBytes []byte, opts hashOptions) (HashResponse, string, *requestError) {
+	hashes, contentSHA, _, reqErr := lookupOrComputeHashes(skinBytes, opts)
+	return hashes, contentSHA, reqErr
+}
+
+// lookupOrComputeHashes is hashContent that also reports whether the
+// result came from the cache.
+func lookupOrComputeHashes(skinBytes []byte, opts hashOptions) (HashResponse, string, bool, *requestError) {
+	contentSHA := sha256Hex(skinBytes)
+	if !opts.batch || knownFilter().mayContain(contentSHA) {
+		if hashes, ok := lookupContent(contentSHA); ok {
+			hashes, reqErr := applyHashOptions(hashes, opts)
+			return hashes, contentSHA, true, reqErr
+		}
+	}
+
+	var hashes HashResponse
+	if upstreamURL() != "" {
+		var reqErr *requestError
+		hashes, reqErr = hashFromUpstream(skinBytes, contentSHA)
+		if reqErr != nil {
+			return HashResponse{}, contentSHA, false, reqErr
 		}
 	} else {
-		file, _, err := r.FormFile("file")
-		if err != nil {
-			http.Error(w, `{"error": "Failed to get uploaded file", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
-			return
+		if !hashLimiter.acquire(hashQueueTimeout()) {
+			return HashResponse{}, contentSHA, false, overloadedError()
 		}
-		defer file.Close()
+		defer hashLimiter.release()
 
-		skinBytes, err = io.ReadAll(file)
+		var err error
+		hashes, err = computeHashes(skinBytes, opts)
 		if err != nil {
-			http.Error(w, `{"error": "Failed to read uploaded file", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
-			return
+			return HashResponse{}, contentSHA, false, hashError(err)
 		}
+	}
 
-		cacheKey = fmt.Sprintf("sha256:%s", sha256Hex(skinBytes))
-		if val, ok := cache.Load(cacheKey); ok {
-			writeJSON(w, val)
-			return
+	storeContent(contentSHA, hashes)
+	observeHash(hashes)
+	hashes, reqErr := applyHashOptions(hashes, opts)
+	return hashes, contentSHA, false, reqErr
+}
+
+// applyHashOptions tailors a (possibly cached) result to the request: it
+// rejects converted images unless convert was asked for and drops the
+// optional hashes that weren't requested, then attaches the hash's tags
+// and blocklist status. The cache always keeps the full result.
+func applyHashOptions(hashes HashResponse, opts hashOptions) (HashResponse, *requestError) {
+	if hashes.ConvertedFrom != "" && !opts.convert {
+		return HashResponse{}, hashError(errNotPNG)
+	}
+	if !opts.downscale {
+		hashes.DownscaledHash = ""
+	}
+	if !opts.analysis {
+		hashes.MirrorInvariant = ""
+		hashes.HueInvariant = ""
+	}
+	if opts.skipStandard {
+		hashes.Standard = ""
+		hashes.StrippedStandard = ""
+	}
+	hashes.Tags = tagsFor(hashes.AlphaNormalized)
+	if label := blockedBy(hashes.Tags); label != "" {
+		if reqErr := blockError(label); reqErr != nil {
+			return HashResponse{}, reqErr
 		}
+		hashes.Blocked = true
 	}
+	return hashes, nil
+}
 
-	hashes, err := computeHashes(skinBytes)
-	if err != nil {
-		http.Error(w, `{"error": "Failed to compute hashes", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
-		return
+func hashError(err error) *requestError {
+	if errors.Is(err, errInvalidDimensions) {
+		return &requestError{status: http.StatusBadRequest, message: "Invalid skin dimensions", details: err.Error()}
 	}
-
-	cache.Store(cacheKey, hashes)
-	writeJSON(w, hashes)
+	if errors.Is(err, errImageTooLarge) {
+		return &requestError{status: http.StatusRequestEntityTooLarge, message: "Image too large", details: err.Error()}
+	}
+	if errors.Is(err, errAnimationTooLarge) {
+		return &requestError{status: http.StatusRequestEntityTooLarge, message: "Animation too large", details: err.Error()}
+	}
+	return &requestError{status: http.StatusInternalServerError, message: "Failed to compute hashes", details: err.Error()}
 }
 
-func computeHashes(imgBytes []byte) (HashResponse, error) {
+func computeHashes(imgBytes []byte, opts hashOptions) (HashResponse, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(imgBytes))
+	if err != nil {
+		return HashResponse{}, fmt.Errorf("image decode failed: %v", err)
+	}
+	if err := checkImageSize(config); err != nil {
+		return HashResponse{}, err
+	}
+	if err := checkSkinDimensions(config.Width, config.Height); err != nil {
+		return HashResponse{}, err
+	}
+
 	img, format, err := image.Decode(bytes.NewReader(imgBytes))
 	if err != nil {
 		return HashResponse{}, fmt.Errorf("image decode failed: %v", err)
 	}
 
-	if strings.ToLower(format) != "png" {
-		return HashResponse{}, fmt.Errorf("only PNG images are supported")
+	var convertedFrom string
+	if format = strings.ToLower(format); format != "png" {
+		if !opts.convert {
+			return HashResponse{}, errNotPNG
+		}
+		convertedFrom = format
 	}
 
-	bounds := img.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
+	canvas := toNRGBA(img)
+	alphaHash := alphaNormalizedHash(canvas)
 
-	rgba := image.NewNRGBA(bounds)
-	draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+	downscaledHash := downscaledSkinHash(img)
 
-	for y := range height {
-		for x := range width {
-			i := rgba.PixOffset(x, y)
-			if rgba.Pix[i+3] == 0 {
-				rgba.Pix[i+0] = 0
-				rgba.Pix[i+1] = 0
-				rgba.Pix[i+2] = 0
-			}
+	flags := featureFlags()
+	var frameHashes []string
+	if flags["animation_frames"] {
+		frameHashes, err = animationFrameHashes(imgBytes, format)
+		if err != nil {
+			return HashResponse{}, err
 		}
 	}
 
-	header := make([]byte, 8)
-	binary.BigEndian.PutUint32(header[0:], uint32(width))
-	binary.BigEndian.PutUint32(header[4:], uint32(height))
-
-	alphaBuffer := append(header, rgba.Pix...)
-	alphaHash := hashBuffer(alphaBuffer)
-
-	buffer := new(bytes.Buffer)
-	err = imaging.Encode(buffer, img, imaging.PNG)
-	if err != nil {
-		return HashResponse{}, err
+	if !opts.skipStandard {
+		buffer := new(bytes.Buffer)
+		err = imaging.Encode(buffer, img, imaging.PNG)
+		if err != nil {
+			return HashResponse{}, err
+		}
 	}
 
 	standardHash := hashBuffer(imgBytes)
-	return HashResponse{
+	var strippedHash string
+	if format == "png" {
+		strippedHash, err = strippedPNGHash(imgBytes)
+		if err != nil {
+			return HashResponse{}, err
+		}
+	}
+
+	hashes := HashResponse{
 		Standard:               standardHash,
+		StrippedStandard:       strippedHash,
 		AlphaNormalized:        alphaHash,
 		AlphaNormalizedCompact: alphaHash[:16],
-	}, nil
+		ConvertedFrom:          convertedFrom,
+		DownscaledHash:         downscaledHash,
+	}
+	if flags["noise_regions"] {
+		hashes.HasNoiseRegions = hasNoiseRegions(canvas)
+	}
+	if flags["invariant_hashes"] {
+		hashes.MirrorInvariant = mirrorInvariantHash(canvas)
+		hashes.HueInvariant = hueInvariantHash(canvas)
+	}
+	if len(frameHashes) > 0 {
+		hashes.Frames = frameHashes
+		hashes.FramesHash = hashBuffer([]byte(strings.Join(hashes.Frames, "")))
+	}
+	if defaultSkins != nil && flags["default_skin_match"] {
+		name, ok := matchDefaultSkin(hashes)
+		hashes.IsDefaultSkin = &ok
+		hashes.DefaultSkin = name
+	}
+	return hashes, nil
+}
+
+// alphaNormalizedHash hashes the image's dimensions followed by its NRGBA
+// pixels (see toNRGBA), with the colour of fully transparent pixels
+// zeroed. img may be the decoded image itself, so each row is normalized
+// in a scratch buffer rather than in place.
+func alphaNormalizedHash(img *image.NRGBA) string {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	row := make([]byte, width*4)
+
+	hash := sha256.New()
+	hash.Write(dimensionHeader(width, height))
+	for y := range height {
+		copy(row, img.Pix[y*img.Stride:])
+		zeroTransparentRow(row)
+		hash.Write(row)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
 func hashBuffer(data []byte) string {
@@ -169,14 +665,3 @@ func writeJSON(w http.ResponseWriter, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
-
-func normalizeURL(raw string) (string, error) {
-	parsed, err := url.Parse(raw)
-	if err != nil {
-		return raw, err
-	}
-
-	parsed.RawQuery = ""
-	parsed.Fragment = ""
-	return parsed.String(), nil
-}
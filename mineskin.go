@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var mineskinClient = &http.Client{Timeout: 60 * time.Second}
+
+type MineSkinResponse struct {
+	Hashes   HashResponse    `json:"hashes"`
+	MineSkin json.RawMessage `json:"mineskin"`
+}
+
+// handleMineSkinUpload hashes an uploaded skin and submits it to MineSkin's
+// synchronous generate endpoint with MINESKIN_API_KEY, returning MineSkin's
+// answer (including the signed texture data) next to our hashes. The
+// variant, visibility and name form values are passed through.
+func handleMineSkinUpload(w http.ResponseWriter, r *http.Request) {
+	skinBytes, reqErr := readUploadedFile(r, hashOptions{})
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	hashes, _, reqErr := hashUpload(skinBytes, hashOptions{})
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, field := range []string{"variant", "visibility", "name"} {
+		if value := r.FormValue(field); value != "" {
+			writer.WriteField(field, value)
+		}
+	}
+	part, err := writer.CreateFormFile("file", "skin.png")
+	if err == nil {
+		_, err = part.Write(skinBytes)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to build MineSkin request", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, getEnvDefault("MINESKIN_API_URL", "https://api.mineskin.org")+"/v2/generate", &body)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to build MineSkin request", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+getEnvDefault("MINESKIN_API_KEY", ""))
+	req.Header.Set("User-Agent", getEnvDefault("MINESKIN_USER_AGENT", "namemc-hash-api"))
+
+	resp, err := mineskinClient.Do(req)
+	if err != nil {
+		http.Error(w, `{"error": "MineSkin request failed", "details": "`+err.Error()+`"}`, http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		http.Error(w, `{"error": "MineSkin request failed", "details": "`+err.Error()+`"}`, http.StatusBadGateway)
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || !json.Valid(data) {
+		http.Error(w, `{"error": "MineSkin request failed", "details": "status `+strconv.Itoa(resp.StatusCode)+`"}`, http.StatusBadGateway)
+		return
+	}
+
+	writeSignedJSON(w, MineSkinResponse{Hashes: hashes, MineSkin: data})
+}
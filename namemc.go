@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const namemcWorkers = 4
+
+var namemcHashPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+type namemcResult struct {
+	NameMCHash string        `json:"namemc_hash"`
+	URL        string        `json:"url"`
+	Hashes     *HashResponse `json:"hashes,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Details    string        `json:"details,omitempty"`
+}
+
+// handleHashNameMC hashes the skins behind a comma-separated list of
+// NameMC skin hashes (hashes=...), fetched from NAMEMC_TEXTURE_URL
+// (default https://s.namemc.com/i/%s.png). NameMC has no public API for
+// profiles, so profile= lookups aren't supported.
+func handleHashNameMC(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("profile") != "" {
+		http.Error(w, `{"error": "Unsupported parameter", "details": "profile lookups need NameMC's website; pass hashes= instead"}`, http.StatusBadRequest)
+		return
+	}
+
+	maxHashes, err := strconv.Atoi(getEnvDefault("NAMEMC_MAX_HASHES", "50"))
+	if err != nil || maxHashes <= 0 {
+		maxHashes = 50
+	}
+
+	var results []namemcResult
+	for hash := range strings.SplitSeq(query.Get("hashes"), ",") {
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		if hash == "" {
+			continue
+		}
+		if !namemcHashPattern.MatchString(hash) {
+			(&requestError{status: http.StatusBadRequest, message: "Invalid NameMC hash", details: hash}).write(w)
+			return
+		}
+		results = append(results, namemcResult{NameMCHash: hash, URL: namemcTextureURL(hash)})
+	}
+
+	if len(results) == 0 || len(results) > maxHashes {
+		http.Error(w, `{"error": "Invalid hashes", "details": "between 1 and `+strconv.Itoa(maxHashes)+` NameMC hashes are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	opts := parseHashOptions(r)
+	slots := make(chan struct{}, namemcWorkers)
+	var wg sync.WaitGroup
+	for i := range results {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(result *namemcResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			hashes, _, reqErr := hashURL(r.Context(), result.URL, opts)
+			auditHashRequest(r, "namemc", result.URL, nil, hashes, reqErr)
+			if reqErr != nil {
+				result.Error, result.Details = reqErr.message, reqErr.details
+				return
+			}
+			result.Hashes = &hashes
+			recordNameMCMapping(result.NameMCHash, hashes.AlphaNormalized)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	writeSignedJSON(w, map[string]any{"results": results})
+}
+
+func namemcTextureURL(hash string) string {
+	return fmt.Sprintf(getEnvDefault("NAMEMC_TEXTURE_URL", "https://s.namemc.com/i/%s.png"), hash)
+}
+
+type namemcMapping struct {
+	NameMCHash string `json:"namemc_hash"`
+	AlphaHash  string `json:"alpha_normalized_hash"`
+}
+
+// namemcMappings links NameMC skin hashes to our alpha-normalized hashes
+// in both directions. It is filled from /hash/namemc results and kept in
+// NAMEMC_MAPPING_FILE when that is set.
+var namemcMappings struct {
+	mu       sync.Mutex
+	toAlpha  map[string]string
+	toNameMC map[string][]string
+}
+
+func loadNameMCMappings() {
+	namemcMappings.toAlpha = make(map[string]string)
+	namemcMappings.toNameMC = make(map[string][]string)
+
+	path := getEnvDefault("NAMEMC_MAPPING_FILE", "")
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Failed to read NameMC mapping file:", err)
+	}
+
+	var list []namemcMapping
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Fatal("Failed to parse NameMC mapping file:", err)
+	}
+	for _, mapping := range list {
+		addNameMCMapping(mapping.NameMCHash, mapping.AlphaHash)
+	}
+	logInfof("Loaded %d NameMC mappings from %s", len(list), path)
+}
+
+// recordNameMCMapping stores a NameMC hash / alpha hash pair and persists
+// the table if the pair is new.
+func recordNameMCMapping(namemcHash string, alphaHash string) {
+	namemcMappings.mu.Lock()
+	changed := namemcMappings.toAlpha[namemcHash] != alphaHash
+	namemcMappings.mu.Unlock()
+
+	if changed {
+		addNameMCMapping(namemcHash, alphaHash)
+		saveNameMCMappings()
+	}
+}
+
+func addNameMCMapping(namemcHash string, alphaHash string) {
+	namemcMappings.mu.Lock()
+	defer namemcMappings.mu.Unlock()
+
+	if previous, ok := namemcMappings.toAlpha[namemcHash]; ok {
+		namemcMappings.toNameMC[previous] = slices.DeleteFunc(namemcMappings.toNameMC[previous], func(h string) bool { return h == namemcHash })
+	}
+	namemcMappings.toAlpha[namemcHash] = alphaHash
+	namemcMappings.toNameMC[alphaHash] = append(namemcMappings.toNameMC[alphaHash], namemcHash)
+}
+
+func saveNameMCMappings() {
+	path := getEnvDefault("NAMEMC_MAPPING_FILE", "")
+	if path == "" {
+		return
+	}
+
+	namemcMappings.mu.Lock()
+	list := make([]namemcMapping, 0, len(namemcMappings.toAlpha))
+	for namemcHash, alphaHash := range namemcMappings.toAlpha {
+		list = append(list, namemcMapping{NameMCHash: namemcHash, AlphaHash: alphaHash})
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(path, data)
+	}
+	namemcMappings.mu.Unlock()
+
+	if err != nil {
+		logErrorf("Failed to write NameMC mapping file: %v", err)
+	}
+}
+
+// handleNameMCMapping looks up the table by our hash (hash=, the full or
+// compact alpha-normalized hash) or by NameMC's (namemc_hash=).
+func handleNameMCMapping(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	namemcMappings.mu.Lock()
+	var matches []namemcMapping
+	if namemcHash := strings.ToLower(query.Get("namemc_hash")); namemcHash != "" {
+		if alphaHash, ok := namemcMappings.toAlpha[namemcHash]; ok {
+			matches = append(matches, namemcMapping{NameMCHash: namemcHash, AlphaHash: alphaHash})
+		}
+	} else if hash := strings.ToLower(query.Get("hash")); hash != "" {
+		for alphaHash, namemcHashes := range namemcMappings.toNameMC {
+			if alphaHash != hash && !(len(hash) == 16 && strings.HasPrefix(alphaHash, hash)) {
+				continue
+			}
+			for _, namemcHash := range namemcHashes {
+				matches = append(matches, namemcMapping{NameMCHash: namemcHash, AlphaHash: alphaHash})
+			}
+		}
+	} else {
+		namemcMappings.mu.Unlock()
+		http.Error(w, `{"error": "Missing hash", "details": "hash or namemc_hash query parameter is required"}`, http.StatusBadRequest)
+		return
+	}
+	namemcMappings.mu.Unlock()
+
+	if len(matches) == 0 {
+		http.Error(w, `{"error": "Mapping not found", "details": ""}`, http.StatusNotFound)
+		return
+	}
+
+	type mappingResult struct {
+		namemcMapping
+		NameMCURL string `json:"namemc_url"`
+	}
+	results := make([]mappingResult, len(matches))
+	for i, match := range matches {
+		results[i] = mappingResult{namemcMapping: match, NameMCURL: "https://namemc.com/skin/" + match.NameMCHash}
+	}
+	writeJSON(w, map[string]any{"mappings": results})
+}
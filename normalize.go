@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// normalizeURL reduces equivalent spellings of a URL to one cache key:
+// scheme and host are lowercased, IDNs converted to punycode, default
+// ports dropped, percent-encoding canonicalized, dot segments resolved
+// and the query and fragment removed.
+func normalizeURL(raw string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw, err
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if _, ok := defaultPorts[parsed.Scheme]; !ok {
+		return raw, fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+
+	host, err := normalizeHost(parsed.Hostname())
+	if err != nil {
+		return raw, err
+	}
+
+	port := parsed.Port()
+	if port == defaultPorts[parsed.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		parsed.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		parsed.Host = "[" + host + "]"
+	default:
+		parsed.Host = host
+	}
+
+	escapedPath := removeDotSegments(normalizePercentEncoding(parsed.EscapedPath()))
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	if parsed.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return raw, err
+	}
+	parsed.RawPath = escapedPath
+
+	parsed.RawQuery = ""
+	parsed.ForceQuery = false
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return parsed.String(), nil
+}
+
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host: %v", err)
+	}
+	return ascii, nil
+}
+
+// normalizePercentEncoding decodes escapes of unreserved characters and
+// uppercases the hex digits of the rest, per RFC 3986 section 6.2.2.
+func normalizePercentEncoding(escaped string) string {
+	var b strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != '%' || i+2 >= len(escaped) || !isHex(escaped[i+1]) || !isHex(escaped[i+2]) {
+			b.WriteByte(escaped[i])
+			continue
+		}
+
+		decoded := unhex(escaped[i+1])<<4 | unhex(escaped[i+2])
+		if isUnreserved(decoded) {
+			b.WriteByte(decoded)
+		} else {
+			b.WriteString(strings.ToUpper(escaped[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func removeDotSegments(path string) string {
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, segment)
+			continue
+		}
+		if last {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
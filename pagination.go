@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// pageRequest is the limit, cursor, since and until query parameters of a
+// list endpoint. Items are ordered by creation time, then ID; the cursor
+// is the (opaque) position of the last item on the previous page.
+type pageRequest struct {
+	limit       int
+	since       time.Time
+	until       time.Time
+	afterTime   time.Time
+	afterID     string
+	afterCursor bool
+}
+
+func parsePageRequest(r *http.Request) (pageRequest, *requestError) {
+	query := r.URL.Query()
+	page := pageRequest{limit: defaultPageLimit}
+	invalid := func(details string) (pageRequest, *requestError) {
+		return pageRequest{}, &requestError{status: http.StatusBadRequest, message: "Invalid pagination", details: details}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			return invalid("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+		page.limit = limit
+	}
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"since", &page.since}, {"until", &page.until}} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return invalid(bound.name + " must be an RFC 3339 time")
+		}
+		*bound.value = parsed
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(raw)
+		timestamp, id, ok := strings.Cut(string(decoded), "|")
+		afterTime, timeErr := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil || !ok || timeErr != nil {
+			return invalid("malformed cursor")
+		}
+		page.afterTime, page.afterID, page.afterCursor = afterTime, id, true
+	}
+	return page, nil
+}
+
+// paginate sorts items by key, keeps those created in [since, until) and
+// after the cursor, and returns up to limit of them along with the cursor
+// for the next page ("" on the last page).
+func paginate[T any](items []T, key func(T) (time.Time, string), page pageRequest) ([]T, string) {
+	compare := func(aTime time.Time, aID string, bTime time.Time, bID string) int {
+		if c := aTime.Compare(bTime); c != 0 {
+			return c
+		}
+		return cmp.Compare(aID, bID)
+	}
+	slices.SortFunc(items, func(a, b T) int {
+		aTime, aID := key(a)
+		bTime, bID := key(b)
+		return compare(aTime, aID, bTime, bID)
+	})
+
+	selected := make([]T, 0, min(len(items), page.limit))
+	for _, item := range items {
+		created, id := key(item)
+		if !page.since.IsZero() && created.Before(page.since) {
+			continue
+		}
+		if !page.until.IsZero() && !created.Before(page.until) {
+			continue
+		}
+		if page.afterCursor && compare(created, id, page.afterTime, page.afterID) <= 0 {
+			continue
+		}
+		if len(selected) == page.limit {
+			last, lastID := key(selected[len(selected)-1])
+			return selected, base64.RawURLEncoding.EncodeToString([]byte(last.Format(time.RFC3339Nano) + "|" + lastID))
+		}
+		selected = append(selected, item)
+	}
+	return selected, ""
+}
+
+// setNextPageLink points a Link: rel="next" header at the next page, so
+// list bodies stay plain JSON arrays.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	if cursor == "" {
+		return
+	}
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	w.Header().Set("Link", "<"+r.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+}
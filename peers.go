@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"hash/crc32"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const peerVirtualNodes = 64
+
+type peerCacheEntry struct {
+	Hashes        *HashResponse `json:"hashes,omitempty"`
+	ContentSHA256 string        `json:"content_sha256,omitempty"`
+}
+
+// peerRing assigns every cache key to one owning replica using consistent
+// hashing, so each peer only asks (and feeds) the owner of a key.
+type peerRing struct {
+	self   string
+	token  string
+	points []uint32
+	owners map[uint32]string
+}
+
+var (
+	peers      *peerRing
+	peerClient = &http.Client{Timeout: 500 * time.Millisecond}
+)
+
+func initPeers() {
+	list := getEnvDefault("CACHE_PEERS", "")
+	if list == "" {
+		return
+	}
+
+	self := strings.TrimRight(getEnvDefault("CACHE_SELF", ""), "/")
+	if self == "" {
+		log.Fatal("CACHE_SELF must be set when CACHE_PEERS is configured")
+	}
+
+	ring := &peerRing{
+		self:   self,
+		token:  getEnvDefault("CACHE_PEER_TOKEN", ""),
+		owners: make(map[uint32]string),
+	}
+
+	for peer := range strings.SplitSeq(list, ",") {
+		peer = strings.TrimRight(strings.TrimSpace(peer), "/")
+		if peer == "" {
+			continue
+		}
+		for i := range peerVirtualNodes {
+			point := crc32.ChecksumIEEE([]byte(peer + "#" + strconv.Itoa(i)))
+			ring.points = append(ring.points, point)
+			ring.owners[point] = peer
+		}
+	}
+	slices.Sort(ring.points)
+
+	peers = ring
+	logInfof("Sharing cache with %d peers", len(ring.points)/peerVirtualNodes)
+}
+
+func (p *peerRing) owner(key string) string {
+	if len(p.points) == 0 {
+		return p.self
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i, _ := slices.BinarySearch(p.points, hash)
+	if i == len(p.points) {
+		i = 0
+	}
+	return p.owners[p.points[i]]
+}
+
+func (p *peerRing) remoteOwner(key string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+
+	owner := p.owner(key)
+	return owner, owner != p.self
+}
+
+func (p *peerRing) newRequest(method string, owner string, key string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, owner+"/peer/cache?key="+url.QueryEscape(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Peer-Token", p.token)
+	return req, nil
+}
+
+func fetchFromPeer(key string) (peerCacheEntry, bool) {
+	owner, remote := peers.remoteOwner(key)
+	if !remote {
+		return peerCacheEntry{}, false
+	}
+
+	req, err := peers.newRequest(http.MethodGet, owner, key, nil)
+	if err != nil {
+		return peerCacheEntry{}, false
+	}
+
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return peerCacheEntry{}, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return peerCacheEntry{}, false
+	}
+
+	var entry peerCacheEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return peerCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func pushToPeer(key string, entry peerCacheEntry) {
+	owner, remote := peers.remoteOwner(key)
+	if !remote {
+		return
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		req, err := peers.newRequest(http.MethodPut, owner, key, body)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := peerClient.Do(req)
+		if err != nil {
+			logWarnf("Failed to share cache entry with %s: %v", owner, err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// handlePeerCache only ever touches the local cache, so a lookup can't
+// bounce between peers that disagree about ownership. Every request must
+// carry CACHE_PEER_TOKEN, which validateConfig requires with CACHE_PEERS.
+func handlePeerCache(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Peer-Token")), []byte(peers.token)) != 1 {
+		http.Error(w, `{"error": "Unauthorized", "details": "invalid peer token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	switch r.Method {
+	case http.MethodGet:
+		val, ok := cache.Load(key)
+		if !ok {
+			http.Error(w, `{"error": "Not found", "details": ""}`, http.StatusNotFound)
+			return
+		}
+
+		switch v := val.(type) {
+		case HashResponse:
+			writeJSON(w, peerCacheEntry{Hashes: &v})
+		case string:
+			writeJSON(w, peerCacheEntry{ContentSHA256: v})
+		}
+	case http.MethodPut:
+		var entry peerCacheEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			(&requestError{status: http.StatusBadRequest, message: "Invalid request body", details: err.Error()}).write(w)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(key, "sha256:") && entry.Hashes != nil:
+			cache.Store(key, *entry.Hashes)
+			rememberHashes(*entry.Hashes)
+		case strings.HasPrefix(key, "url:") && entry.ContentSHA256 != "":
+			cache.Store(key, entry.ContentSHA256)
+		default:
+			(&requestError{status: http.StatusBadRequest, message: "Invalid cache entry", details: key}).write(w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"error": "Method not allowed", "details": ""}`, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a PNG file")
+	}
+
+	var chunks []pngChunk
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		length := binary.BigEndian.Uint32(rest)
+		if uint64(length) > uint64(len(rest)-12) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{kind: string(rest[4:8]), data: rest[8 : 8+length]})
+		if string(rest[4:8]) == "IEND" {
+			break
+		}
+		rest = rest[12+length:]
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, kind string, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	buf.WriteString(kind)
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+// strippedPNGHash hashes the PNG with every ancillary chunk (lowercase
+// first letter: tEXt, tIME, gAMA, ...) removed, so files differing only
+// in metadata hash the same.
+func strippedPNGHash(data []byte) (string, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	for _, chunk := range chunks {
+		if chunk.kind[0]&0x20 != 0 {
+			continue
+		}
+		writePNGChunk(&buf, chunk.kind, chunk.data)
+	}
+	return hashBuffer(buf.Bytes()), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+// checkFetchURL applies the outbound host rules to one hop of a fetch.
+// With ALLOWED_HOSTS set (comma-separated, "*.example.com" matches
+// subdomains) only those hosts may be fetched. The host is normalized
+// first so encodings like trailing dots or IDN spellings can't slip past.
+func checkFetchURL(target *url.URL) error {
+	scheme := strings.ToLower(target.Scheme)
+	if _, ok := defaultPorts[scheme]; !ok {
+		return fmt.Errorf("scheme %q is not allowed", target.Scheme)
+	}
+
+	host, err := normalizeHost(target.Hostname())
+	if err != nil {
+		return err
+	}
+
+	allowed := getEnvDefault("ALLOWED_HOSTS", "")
+	if allowed == "" {
+		return nil
+	}
+
+	for pattern := range strings.SplitSeq(allowed, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return nil
+			}
+		} else if host == pattern {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not allowed", host)
+}
+
+// checkRedirect re-applies checkFetchURL to every redirect hop and stops
+// after MAX_REDIRECTS (default 5) hops.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects, err := strconv.Atoi(getEnvDefault("MAX_REDIRECTS", "5"))
+	if err != nil {
+		maxRedirects = 5
+	}
+	if len(via) > maxRedirects {
+		return errTooManyRedirects
+	}
+	return checkFetchURL(req.URL)
+}
+
+// checkDialAddress refuses loopback, private, link-local and unspecified
+// addresses when BLOCK_PRIVATE_NETWORKS=true. It runs on the resolved IP
+// so DNS tricks pointing public names at internal hosts are caught too.
+func checkDialAddress(addr string) error {
+	if getEnvDefault("BLOCK_PRIVATE_NETWORKS", "false") != "true" {
+		return nil
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("address %s is not allowed", addr)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// setCacheHeaders lets intermediaries cache results: content-addressed
+// results never change, URL-based ones are cacheable for
+// URL_CACHE_MAX_AGE seconds (default 300) with Age reflecting when the
+// URL was last fetched. Responses become private when JWT auth is on.
+func setCacheHeaders(w http.ResponseWriter, fromURL bool, source SourceInfo) {
+	visibility := "public"
+	if loadJWTConfig() != nil {
+		visibility = "private"
+	}
+
+	if !fromURL {
+		w.Header().Set("Cache-Control", visibility+", max-age=31536000, immutable")
+		return
+	}
+
+	maxAge := getEnvDefault("URL_CACHE_MAX_AGE", "300")
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%s", visibility, maxAge))
+	if source.Cached && source.FetchedAt != nil {
+		w.Header().Set("Age", fmt.Sprintf("%d", int(time.Since(*source.FetchedAt).Seconds())))
+	}
+}
+
+// writeHashResponse writes hashes as JSON, trimmed to the comma-separated
+// top-level keys in the fields query parameter when one is given.
+func writeHashResponse(w http.ResponseWriter, r *http.Request, hashes any) {
+	fields := r.URL.Query().Get("fields")
+	if fields == "" {
+		writeSignedJSON(w, hashes)
+		return
+	}
+
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to encode response", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		http.Error(w, `{"error": "Failed to encode response", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		return
+	}
+
+	selected := make(map[string]json.RawMessage)
+	for field := range strings.SplitSeq(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		value, ok := all[field]
+		if !ok && responseFields()[field] {
+			// A known field that is empty for this result is left out.
+			continue
+		}
+		if !ok {
+			(&requestError{status: http.StatusBadRequest, message: "Invalid fields", details: "unknown field " + field}).write(w)
+			return
+		}
+		selected[field] = value
+	}
+
+	writeSignedJSON(w, selected)
+}
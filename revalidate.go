@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// urlState tracks freshness, popularity and upstream validators of a url:
+// cache entry so hot entries can be served stale while they are refreshed
+// in the background, and refreshes can be conditional.
+type urlState struct {
+	mu           sync.Mutex
+	fetchedAt    time.Time
+	source       SourceInfo
+	validators   urlValidators
+	hits         atomic.Int64
+	revalidating atomic.Bool
+}
+
+type urlValidators struct {
+	etag         string
+	lastModified string
+}
+
+var urlStates sync.Map
+
+func urlStateFor(cleanedURL string) *urlState {
+	val, _ := urlStates.LoadOrStore(cleanedURL, &urlState{})
+	return val.(*urlState)
+}
+
+func markURLFetched(cleanedURL string, source SourceInfo, result fetchResult) {
+	state := urlStateFor(cleanedURL)
+	state.mu.Lock()
+	state.fetchedAt = time.Now()
+	state.source = source
+	if !result.notModified {
+		state.validators = urlValidators{etag: result.etag, lastModified: result.lastModified}
+	}
+	state.mu.Unlock()
+	state.hits.Store(0)
+}
+
+// lastURLSource returns what was recorded about the most recent fetch of
+// cleanedURL by this process, if anything.
+func lastURLSource(cleanedURL string) SourceInfo {
+	val, ok := urlStates.Load(cleanedURL)
+	if !ok {
+		return SourceInfo{}
+	}
+
+	state := val.(*urlState)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.source
+}
+
+func cacheURLFor(rawURL string) string {
+	cleanedURL, err := normalizeURL(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return cleanedURL
+}
+
+// refreshURL refetches rawURL bypassing the cache and updates its entry.
+// When validators from an earlier fetch are known the request is
+// conditional, and a 304 reuses the cached hashes without recomputing.
+func refreshURL(ctx context.Context, rawURL string) (HashResponse, *requestError) {
+	cleanedURL := cacheURLFor(rawURL)
+
+	var validators urlValidators
+	if val, ok := urlStates.Load(cleanedURL); ok {
+		state := val.(*urlState)
+		state.mu.Lock()
+		validators = state.validators
+		state.mu.Unlock()
+	}
+
+	result, reqErr := fetchURLConditional(ctx, rawURL, validators)
+	if reqErr != nil {
+		return HashResponse{}, reqErr
+	}
+
+	if result.notModified {
+		if contentSHA, ok := lookupURLContent(cleanedURL); ok {
+			if hashes, ok := lookupContent(contentSHA); ok {
+				markURLFetched(cleanedURL, newSourceInfo(rawURL, cleanedURL, result), result)
+				return hashes, nil
+			}
+		}
+
+		result, reqErr = fetchURL(ctx, rawURL)
+		if reqErr != nil {
+			return HashResponse{}, reqErr
+		}
+	}
+
+	hashes, contentSHA, reqErr := hashContent(result.body, hashOptions{})
+	if reqErr != nil {
+		return HashResponse{}, reqErr
+	}
+
+	storeURLContent(cleanedURL, contentSHA)
+	markURLFetched(cleanedURL, newSourceInfo(rawURL, cleanedURL, result), result)
+	return hashes, nil
+}
+
+// maybeRevalidate refetches rawURL in the background once its entry is
+// older than REVALIDATE_AFTER_MS and has been served at least
+// REVALIDATE_MIN_HITS times since the last fetch. Disabled when
+// REVALIDATE_AFTER_MS is unset or 0.
+func maybeRevalidate(cleanedURL string, rawURL string) {
+	after := envDuration("REVALIDATE_AFTER_MS", 0)
+	if after <= 0 {
+		return
+	}
+
+	minHits, err := strconv.ParseInt(getEnvDefault("REVALIDATE_MIN_HITS", "5"), 10, 64)
+	if err != nil {
+		minHits = 5
+	}
+
+	state := urlStateFor(cleanedURL)
+	hits := state.hits.Add(1)
+
+	state.mu.Lock()
+	stale := time.Since(state.fetchedAt) > after
+	state.mu.Unlock()
+
+	if !stale || hits < minHits || !state.revalidating.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer state.revalidating.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout())
+		defer cancel()
+
+		refreshURL(ctx, rawURL)
+	}()
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rpcWorkers = 8
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	// rpcServerError carries a requestError; its HTTP status and details
+	// are in the error's data.
+	rpcServerError = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    *rpcErrorData `json:"data,omitempty"`
+}
+
+type rpcErrorData struct {
+	Status  int    `json:"status,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+type rpcHashParams struct {
+	URL           string   `json:"url"`
+	Source        string   `json:"source"`
+	ContentSHA256 string   `json:"content_sha256"`
+	Data          []byte   `json:"data"`
+	Convert       bool     `json:"convert"`
+	Downscale     bool     `json:"downscale"`
+	Analysis      bool     `json:"analysis"`
+	Skip          []string `json:"skip"`
+}
+
+type rpcTagsParams struct {
+	Hash string `json:"hash"`
+}
+
+// rpcMethods maps each method to the same operation its HTTP route runs:
+// "hash" takes one of url, source, content_sha256 or base64 data along
+// with the /hash options, and "tags.get" takes a hash.
+var rpcMethods = map[string]func(r *http.Request, params json.RawMessage) (any, *rpcError){
+	"hash":     rpcHash,
+	"tags.get": rpcGetTags,
+}
+
+// handleRPC serves JSON-RPC 2.0 calls, singly or as a batch of up to
+// RPC_MAX_BATCH (default 50) run concurrently. Notifications (calls
+// without an id) are run but get no response.
+func handleRPC(w http.ResponseWriter, r *http.Request) {
+	maxBatch, err := strconv.Atoi(getEnvDefault("RPC_MAX_BATCH", "50"))
+	if err != nil || maxBatch <= 0 {
+		maxBatch = 50
+	}
+
+	// Room for every call in a full batch to carry a base64 upload.
+	r.Body = http.MaxBytesReader(nil, r.Body, int64(maxBatch)*(maxUploadBytes()*4/3+multipartOverheadBytes))
+	body, err := io.ReadAll(r.Body)
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		uploadTooLargeError(maxUploadBytes()).write(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Invalid request body", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("[")) {
+		var call json.RawMessage
+		if err := json.Unmarshal(body, &call); err != nil {
+			writeJSON(w, rpcErrorResponse(nil, rpcParseError, "Parse error", err.Error()))
+			return
+		}
+		if resp, ok := runRPCCall(r, call); ok {
+			writeSignedJSON(w, resp)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	var calls []json.RawMessage
+	if err := json.Unmarshal(body, &calls); err != nil {
+		writeJSON(w, rpcErrorResponse(nil, rpcParseError, "Parse error", err.Error()))
+		return
+	}
+	if len(calls) == 0 {
+		writeJSON(w, rpcErrorResponse(nil, rpcInvalidRequest, "Invalid Request", "empty batch"))
+		return
+	}
+	if len(calls) > maxBatch {
+		writeJSON(w, rpcErrorResponse(nil, rpcInvalidRequest, "Invalid Request", fmt.Sprintf("batch has %d calls, limit is %d", len(calls), maxBatch)))
+		return
+	}
+
+	responses := make([]*rpcResponse, len(calls))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, rpcWorkers)
+	for i, call := range calls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if resp, ok := runRPCCall(r, call); ok {
+				responses[i] = &resp
+			}
+		}()
+	}
+	wg.Wait()
+
+	results := make([]*rpcResponse, 0, len(responses))
+	for _, resp := range responses {
+		if resp != nil {
+			results = append(results, resp)
+		}
+	}
+	if len(results) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeSignedJSON(w, results)
+}
+
+// runRPCCall runs one call and reports whether it needs a response.
+func runRPCCall(r *http.Request, call json.RawMessage) (resp rpcResponse, respond bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(call, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcErrorResponse(nil, rpcInvalidRequest, "Invalid Request", "expected a JSON-RPC 2.0 request object"), true
+	}
+	respond = req.ID != nil
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			resp = rpcErrorResponse(req.ID, rpcInternalError, "Internal error", fmt.Sprintf("%v", rec))
+		}
+	}()
+
+	method, ok := rpcMethods[req.Method]
+	if !ok {
+		return rpcErrorResponse(req.ID, rpcMethodNotFound, "Method not found", req.Method), respond
+	}
+	result, callErr := method(r, req.Params)
+	if callErr != nil {
+		return rpcResponse{JSONRPC: "2.0", Error: callErr, ID: req.ID}, respond
+	}
+	return rpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}, respond
+}
+
+func rpcErrorResponse(id json.RawMessage, code int, message string, details string) rpcResponse {
+	return rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: code, Message: message, Data: &rpcErrorData{Details: details}}, ID: id}
+}
+
+func rpcRequestError(reqErr *requestError) *rpcError {
+	return &rpcError{Code: rpcServerError, Message: reqErr.message, Data: &rpcErrorData{Status: reqErr.status, Details: reqErr.details}}
+}
+
+func decodeRPCParams(params json.RawMessage, v any) *rpcError {
+	if len(params) == 0 {
+		return &rpcError{Code: rpcInvalidParams, Message: "Invalid params", Data: &rpcErrorData{Details: "params object is required"}}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: "Invalid params", Data: &rpcErrorData{Details: err.Error()}}
+	}
+	return nil
+}
+
+func rpcHash(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	var p rpcHashParams
+	if callErr := decodeRPCParams(params, &p); callErr != nil {
+		return nil, callErr
+	}
+
+	inputs := 0
+	for _, given := range []bool{p.URL != "", p.Source != "", p.ContentSHA256 != "", p.Data != nil} {
+		if given {
+			inputs++
+		}
+	}
+	if inputs != 1 {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params", Data: &rpcErrorData{Details: "exactly one of url, source, content_sha256 or data is required"}}
+	}
+	for _, skip := range p.Skip {
+		if skip != "standard" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params", Data: &rpcErrorData{Details: "unknown skip value " + skip}}
+		}
+	}
+
+	opts := hashOptions{convert: p.Convert, downscale: p.Downscale, analysis: p.Analysis, skipStandard: len(p.Skip) > 0}
+	started := time.Now()
+	var hashes HashResponse
+	var source SourceInfo
+	var reqErr *requestError
+
+	rawURL := p.URL
+	if p.Source != "" {
+		rawURL, reqErr = resolveSource(r.Context(), p.Source)
+	}
+	contentSHA := strings.ToLower(p.ContentSHA256)
+	switch {
+	case reqErr != nil:
+	case rawURL != "":
+		hashes, source, reqErr = hashURL(r.Context(), rawURL, opts)
+	case contentSHA != "":
+		if !sha256Pattern.MatchString(contentSHA) {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params", Data: &rpcErrorData{Details: "content_sha256 must be 64 hex characters"}}
+		}
+		hashes, source, reqErr = hashKnownContent(contentSHA, opts)
+	default:
+		if int64(len(p.Data)) > maxUploadBytes() {
+			reqErr = uploadTooLargeError(maxUploadBytes())
+		} else if reqErr = checkUploadType(p.Data, "", opts); reqErr == nil {
+			hashes, source, reqErr = hashUpload(p.Data, opts)
+		}
+	}
+
+	auditHashRequest(r, "rpc", rawURL, p.Data, hashes, reqErr)
+	emitHashEvent("rpc", rawURL, hashes, source, started, reqErr)
+	trackHashRequest(r, "rpc", rawURL, reqErr)
+	if reqErr != nil {
+		return nil, rpcRequestError(reqErr)
+	}
+	return hashes, nil
+}
+
+func rpcGetTags(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	var p rpcTagsParams
+	if callErr := decodeRPCParams(params, &p); callErr != nil {
+		return nil, callErr
+	}
+	tags := tagsFor(p.Hash)
+	if tags == nil {
+		tags = []Tag{}
+	}
+	return taggedHash{Hash: p.Hash, Tags: tags}, nil
+}
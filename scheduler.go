@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	hostSlots   = make(map[string]chan struct{})
+	hostSlotsMu sync.Mutex
+	saveMu      sync.Mutex
+)
+
+func startScheduler() {
+	loadSubscriptions()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			dispatchDueSubscriptions()
+		}
+	}()
+}
+
+func dispatchDueSubscriptions() {
+	now := time.Now()
+
+	subscriptionsMu.Lock()
+	var due []*Subscription
+	for _, sub := range subscriptions {
+		if !sub.running && !now.Before(sub.NextCheckAt) {
+			sub.running = true
+			due = append(due, sub)
+		}
+	}
+	subscriptionsMu.Unlock()
+
+	for _, sub := range due {
+		go runScheduledCheck(sub)
+	}
+}
+
+func runScheduledCheck(sub *Subscription) {
+	release := acquireHostSlot(sub.URL)
+	checkSubscription(sub)
+	release()
+
+	subscriptionsMu.Lock()
+	sub.running = false
+	sub.NextCheckAt = nextCheckTime(sub.IntervalSeconds)
+	subscriptionsMu.Unlock()
+
+	saveSubscriptions()
+}
+
+// nextCheckTime spreads checks by up to SUBSCRIPTION_JITTER (a fraction of
+// the interval) in either direction so subscriptions created together
+// don't hit upstream hosts in lockstep.
+func nextCheckTime(intervalSeconds int) time.Time {
+	interval := time.Duration(intervalSeconds) * time.Second
+	jitter, _ := strconv.ParseFloat(getEnvDefault("SUBSCRIPTION_JITTER", "0.1"), 64)
+	if jitter > 0 {
+		interval += time.Duration((rand.Float64()*2 - 1) * jitter * float64(interval))
+	}
+	return time.Now().UTC().Add(interval)
+}
+
+func acquireHostSlot(rawURL string) func() {
+	host := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil {
+		host = parsed.Host
+	}
+
+	hostSlotsMu.Lock()
+	slots, ok := hostSlots[host]
+	if !ok {
+		limit, err := strconv.Atoi(getEnvDefault("SUBSCRIPTION_HOST_CONCURRENCY", "2"))
+		if err != nil || limit < 1 {
+			limit = 1
+		}
+		slots = make(chan struct{}, limit)
+		hostSlots[host] = slots
+	}
+	hostSlotsMu.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+func loadSubscriptions() {
+	path := getEnvDefault("SUBSCRIPTIONS_FILE", "")
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Failed to read subscriptions file:", err)
+	}
+
+	var list []*Subscription
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Fatal("Failed to parse subscriptions file:", err)
+	}
+
+	subscriptionsMu.Lock()
+	for _, sub := range list {
+		subscriptions[sub.ID] = sub
+	}
+	subscriptionsMu.Unlock()
+
+	logInfof("Loaded %d subscriptions from %s", len(list), path)
+}
+
+func saveSubscriptions() {
+	path := getEnvDefault("SUBSCRIPTIONS_FILE", "")
+	if path == "" {
+		return
+	}
+
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	subscriptionsMu.Lock()
+	list := make([]Subscription, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		list = append(list, *sub)
+	}
+	subscriptionsMu.Unlock()
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		logErrorf("Failed to encode subscriptions: %v", err)
+		return
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		logErrorf("Failed to write subscriptions file: %v", err)
+	}
+}
+
+// writeFileAtomic replaces path with data via a temporary file, so a crash
+// mid-write never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
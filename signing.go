@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+)
+
+type responseSigner struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+var (
+	signer     *responseSigner
+	signerOnce sync.Once
+)
+
+// responseSigningKey returns the signer for RESPONSE_SIGNING_KEY, a
+// base64 Ed25519 seed (32 bytes) or private key (64 bytes), or nil when
+// signing is off.
+func responseSigningKey() *responseSigner {
+	signerOnce.Do(func() {
+		encoded := getEnvDefault("RESPONSE_SIGNING_KEY", "")
+		if encoded == "" {
+			return
+		}
+		key, err := parseSigningKey(encoded)
+		if err != nil {
+			log.Fatal("Invalid RESPONSE_SIGNING_KEY: ", err)
+		}
+		sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+		signer = &responseSigner{key: key, keyID: hex.EncodeToString(sum[:8])}
+	})
+	return signer
+}
+
+func parseSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, errors.New("must be a 32-byte seed or 64-byte private key")
+}
+
+// writeSignedJSON writes data like writeJSON. With a signing key
+// configured, X-Signature-Ed25519 carries a detached signature over the
+// exact body bytes and X-Signature-Key-Id names the key in the
+// /.well-known/jwks.json key set.
+func writeSignedJSON(w http.ResponseWriter, data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to encode response", "details": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	if signature, keyID := signBody(body); signature != "" {
+		w.Header().Set("X-Signature-Ed25519", signature)
+		w.Header().Set("X-Signature-Key-Id", keyID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// signBody returns the base64 detached signature over body and the key
+// id, or empty strings when signing is off.
+func signBody(body []byte) (signature string, keyID string) {
+	s := responseSigningKey()
+	if s == nil {
+		return "", ""
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, body)), s.keyID
+}
+
+type signingJWK struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+}
+
+func handleSigningKeys(w http.ResponseWriter, r *http.Request) {
+	keys := []signingJWK{}
+	if s := responseSigningKey(); s != nil {
+		keys = append(keys, signingJWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+			KeyID:   s.keyID,
+			Use:     "sig",
+			Alg:     "EdDSA",
+		})
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, map[string]any{"keys": keys})
+}
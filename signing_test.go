@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func useTestSigner(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerOnce.Do(func() {})
+	previous := signer
+	signer = &responseSigner{key: private, keyID: "test"}
+	t.Cleanup(func() { signer = previous })
+	return public
+}
+
+func verifySignature(t *testing.T, public ed25519.PublicKey, body []byte, signature string) {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatalf("signature %q is not base64: %v", signature, err)
+	}
+	if !ed25519.Verify(public, body, raw) {
+		t.Fatal("signature does not verify")
+	}
+}
+
+func TestWriteSignedJSON(t *testing.T) {
+	public := useTestSigner(t)
+
+	rec := httptest.NewRecorder()
+	writeSignedJSON(rec, map[string]string{"alpha_normalized_hash": "abc"})
+	if got := rec.Header().Get("X-Signature-Key-Id"); got != "test" {
+		t.Errorf("X-Signature-Key-Id = %q, want test", got)
+	}
+	verifySignature(t, public, rec.Body.Bytes(), rec.Header().Get("X-Signature-Ed25519"))
+}
+
+func TestWebSocketFrameSignature(t *testing.T) {
+	public := useTestSigner(t)
+	skin, err := os.ReadFile("conformance/skin_64x64.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initHashLimiter()
+	r := httptest.NewRequest("GET", "/ws", nil)
+	resp := processWebSocketFrame(r.Context(), r, 0, wsFrame{payloadType: websocket.BinaryFrame, data: skin})
+	if resp.Error != "" {
+		t.Fatalf("frame failed: %s: %s", resp.Error, resp.Details)
+	}
+	if resp.KeyID != "test" {
+		t.Errorf("key_id = %q, want test", resp.KeyID)
+	}
+	verifySignature(t, public, resp.Result, resp.Signature)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+const skinBaseWidth = 64
+
+var errInvalidDimensions = errors.New("HD skins must be a power-of-two multiple of 64x64 or 64x32")
+
+// checkSkinDimensions rejects HD sizes (wider than 64px) that aren't a
+// power-of-two multiple of 64x64 or 64x32. computeHashes runs it on the
+// header, before the image is decoded.
+func checkSkinDimensions(width int, height int) error {
+	if width <= skinBaseWidth {
+		return nil
+	}
+
+	scale := width / skinBaseWidth
+	if width%skinBaseWidth != 0 || scale&(scale-1) != 0 || (height != width && height != width/2) {
+		return fmt.Errorf("%w, got %dx%d", errInvalidDimensions, width, height)
+	}
+	return nil
+}
+
+// downscaledSkinHash returns the alpha-normalized hash of an HD skin
+// resized (nearest-neighbour) to 64px wide, so HD and SD exports of the
+// same skin can be matched. Images up to 64px wide return "". The size
+// must already have passed checkSkinDimensions.
+func downscaledSkinHash(img image.Image) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= skinBaseWidth {
+		return ""
+	}
+
+	scale := width / skinBaseWidth
+	return alphaNormalizedHash(imaging.Resize(img, skinBaseWidth, height/scale, imaging.NearestNeighbor))
+}
+
+// skinRegions are the UV rectangles of a 64x64 skin that are mapped onto
+// the player model (classic arm width, which covers slim arms too). The
+// first five are the only ones present in legacy 64x32 skins.
+var skinRegions = []image.Rectangle{
+	image.Rect(8, 0, 24, 8), image.Rect(0, 8, 32, 16), // head
+	image.Rect(40, 0, 56, 8), image.Rect(32, 8, 64, 16), // hat
+	image.Rect(4, 16, 12, 20), image.Rect(0, 20, 16, 32), // right leg
+	image.Rect(20, 16, 36, 20), image.Rect(16, 20, 40, 32), // body
+	image.Rect(44, 16, 52, 20), image.Rect(40, 20, 56, 32), // right arm
+	image.Rect(4, 32, 12, 36), image.Rect(0, 36, 16, 48), // right leg overlay
+	image.Rect(20, 32, 36, 36), image.Rect(16, 36, 40, 48), // body overlay
+	image.Rect(44, 32, 52, 36), image.Rect(40, 36, 56, 48), // right arm overlay
+	image.Rect(4, 48, 12, 52), image.Rect(0, 52, 16, 64), // left leg overlay
+	image.Rect(20, 48, 28, 52), image.Rect(16, 52, 32, 64), // left leg
+	image.Rect(36, 48, 44, 52), image.Rect(32, 52, 48, 64), // left arm
+	image.Rect(52, 48, 60, 52), image.Rect(48, 52, 64, 64), // left arm overlay
+}
+
+// hasNoiseRegions reports whether any pixel outside skinRegions is neither
+// transparent nor black. Some editors leave such noise behind and others
+// clear it, which changes the hash of otherwise identical skins. Returns
+// nil for images that don't have skin dimensions.
+func hasNoiseRegions(img *image.NRGBA) *bool {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < skinBaseWidth || width%skinBaseWidth != 0 || (height != width && height != width/2) {
+		return nil
+	}
+	scale := width / skinBaseWidth
+
+	used := make([]bool, width*height)
+	for _, region := range skinRegions {
+		region = image.Rect(region.Min.X*scale, region.Min.Y*scale, region.Max.X*scale, region.Max.Y*scale)
+		region = region.Intersect(image.Rect(0, 0, width, height))
+		for y := region.Min.Y; y < region.Max.Y; y++ {
+			for x := region.Min.X; x < region.Max.X; x++ {
+				used[y*width+x] = true
+			}
+		}
+	}
+
+	noise := false
+	for y := range height {
+		for x := range width {
+			if used[y*width+x] {
+				continue
+			}
+			i := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			if img.Pix[i+3] != 0 && (img.Pix[i] != 0 || img.Pix[i+1] != 0 || img.Pix[i+2] != 0) {
+				noise = true
+				return &noise
+			}
+		}
+	}
+	return &noise
+}
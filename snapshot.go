@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type cacheSnapshotEntry struct {
+	Key string `json:"key"`
+	peerCacheEntry
+}
+
+func handleCacheExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="cache.ndjson"`)
+	if _, err := writeCacheSnapshot(w); err != nil {
+		logErrorf("Cache export failed: %v", err)
+	}
+}
+
+func handleCacheImport(w http.ResponseWriter, r *http.Request) {
+	imported, err := readCacheSnapshot(r.Body)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to import cache snapshot", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]int{"imported": imported})
+}
+
+func writeCacheSnapshot(w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	written := 0
+
+	var err error
+	cache.Range(func(key, val any) bool {
+		entry := cacheSnapshotEntry{Key: key.(string)}
+		switch v := val.(type) {
+		case HashResponse:
+			entry.Hashes = &v
+		case string:
+			entry.ContentSHA256 = v
+		default:
+			return true
+		}
+
+		if err = encoder.Encode(entry); err != nil {
+			return false
+		}
+		written++
+		return true
+	})
+
+	return written, err
+}
+
+func readCacheSnapshot(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	imported := 0
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var entry cacheSnapshotEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return imported, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		switch {
+		case strings.HasPrefix(entry.Key, "sha256:") && entry.Hashes != nil:
+			cache.Store(entry.Key, *entry.Hashes)
+			rememberHashes(*entry.Hashes)
+		case strings.HasPrefix(entry.Key, "url:") && entry.ContentSHA256 != "":
+			cache.Store(entry.Key, entry.ContentSHA256)
+		default:
+			return imported, fmt.Errorf("line %d: invalid entry for key %q", line, entry.Key)
+		}
+		imported++
+	}
+
+	return imported, scanner.Err()
+}
+
+func importCacheSnapshotFile(path string) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Failed to open cache snapshot:", err)
+	}
+	defer file.Close()
+
+	imported, err := readCacheSnapshot(file)
+	if err != nil {
+		log.Fatal("Failed to import cache snapshot:", err)
+	}
+	logInfof("Imported %d cache entries from %s", imported, path)
+}
+
+func exportCacheSnapshotFile(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	written, err := writeCacheSnapshot(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	logInfof("Exported %d cache entries to %s", written, path)
+	return os.Rename(tmp, path)
+}
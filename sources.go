@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+type eraseResponse struct {
+	URL    string `json:"url"`
+	Erased bool   `json:"erased"`
+	// Kept names the records that can still contain the URL; see
+	// handleDeleteSource.
+	Kept []string `json:"kept,omitempty"`
+}
+
+// handleDeleteSource erases what this process keeps in memory about a
+// source URL, given as url= or as source=<adapter>:<id> for a username or
+// UUID: its url: cache entry, fetch metadata, negative cache entries and
+// any recent errors naming it. Content hashes, and counts derived from
+// them, are anonymous and stay.
+//
+// Some records are not touched and are listed in the response's kept
+// field: the append-only audit log ("audit_log"), events already sent to
+// EVENT_SINK_URL ("event_sink") and subscriptions watching the URL
+// ("subscription:<id>"), which their owner deletes. Cache peers and
+// upstream instances keep their own copies and need the same request.
+// Erasure is audited, without the URL.
+func handleDeleteSource(w http.ResponseWriter, r *http.Request) {
+	subject := requestSubject(r)
+	if subject == "" {
+		writeUnauthorized(w, "erasure requires an authenticated client")
+		return
+	}
+
+	query := r.URL.Query()
+	rawURL := query.Get("url")
+	if rawURL == "" && query.Get("source") != "" {
+		var reqErr *requestError
+		rawURL, reqErr = resolveSource(r.Context(), query.Get("source"))
+		if reqErr != nil {
+			reqErr.write(w)
+			return
+		}
+	}
+	if rawURL == "" {
+		http.Error(w, `{"error": "Missing URL", "details": "url or source query parameter is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	cleanedURL, err := normalizeURL(rawURL)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid URL", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	erased := forgetURL(cleanedURL)
+	if auditEnabled() {
+		writeAuditEntry(AuditEntry{
+			Time:       time.Now().UTC(),
+			Subject:    subject,
+			RemoteAddr: r.RemoteAddr,
+			Channel:    "erase",
+			Status:     http.StatusOK,
+		})
+	}
+	writeJSON(w, eraseResponse{URL: cleanedURL, Erased: erased, Kept: keptRecords(cleanedURL)})
+}
+
+// keptRecords lists the records forgetURL leaves that may name cleanedURL.
+func keptRecords(cleanedURL string) []string {
+	var kept []string
+	if auditEnabled() {
+		kept = append(kept, "audit_log")
+	}
+	if getEnvDefault("EVENT_SINK_URL", "") != "" {
+		kept = append(kept, "event_sink")
+	}
+
+	subscriptionsMu.Lock()
+	for _, sub := range subscriptions {
+		if cacheURLFor(sub.URL) == cleanedURL {
+			kept = append(kept, "subscription:"+sub.ID)
+		}
+	}
+	subscriptionsMu.Unlock()
+	slices.Sort(kept)
+	return kept
+}
+
+// forgetURL drops the in-memory records tied to cleanedURL and reports
+// whether there were any.
+func forgetURL(cleanedURL string) bool {
+	_, erased := cache.LoadAndDelete(urlCacheKey(cleanedURL))
+	if _, ok := urlStates.LoadAndDelete(cleanedURL); ok {
+		erased = true
+	}
+
+	if _, ok := negativeCache.LoadAndDelete(cleanedURL); ok {
+		erased = true
+	}
+
+	activity.mu.Lock()
+	before := len(activity.errors)
+	activity.errors = slices.DeleteFunc(activity.errors, func(e recentError) bool {
+		return e.SourceURL != "" && cacheURLFor(e.SourceURL) == cleanedURL
+	})
+	if len(activity.errors) != before {
+		erased = true
+	}
+	activity.mu.Unlock()
+
+	return erased
+}
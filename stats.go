@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+)
+
+type StatsResponse struct {
+	CacheEntries int                     `json:"cache_entries"`
+	HashLimiter  limiterStats            `json:"hash_limiter"`
+	FetchHosts   map[string]limiterStats `json:"fetch_hosts"`
+	Warmup       *warmupStats            `json:"warmup,omitempty"`
+	EventSink    *eventSinkStats         `json:"event_sink,omitempty"`
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, collectStats())
+}
+
+func collectStats() StatsResponse {
+	entries := 0
+	cache.Range(func(_, _ any) bool {
+		entries++
+		return true
+	})
+
+	fetchHosts := make(map[string]limiterStats)
+	hostLimiters.Range(func(host, limiter any) bool {
+		fetchHosts[host.(string)] = limiter.(*concurrencyLimiter).stats()
+		return true
+	})
+
+	return StatsResponse{
+		CacheEntries: entries,
+		FetchHosts:   fetchHosts,
+		HashLimiter:  hashLimiter.stats(),
+		Warmup:       currentWarmupStats(),
+		EventSink:    currentEventSinkStats(),
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// startStatsD periodically pushes the /stats numbers to a StatsD or
+// DogStatsD agent at STATSD_ADDR over UDP. STATSD_TAGS (comma-separated
+// key:value pairs) are appended in DogStatsD format.
+func startStatsD() {
+	addr := getEnvDefault("STATSD_ADDR", "")
+	if addr == "" {
+		return
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		logErrorf("Failed to set up StatsD exporter: %v", err)
+		return
+	}
+
+	prefix := getEnvDefault("STATSD_PREFIX", "namemc_hash_api.")
+	tags := ""
+	if raw := getEnvDefault("STATSD_TAGS", ""); raw != "" {
+		tags = "|#" + raw
+	}
+	interval := envDuration("STATSD_INTERVAL_MS", 10*time.Second)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastShed int64
+		for range ticker.C {
+			stats := collectStats()
+			metrics := []string{
+				gaugeLine(prefix+"cache.entries", int64(stats.CacheEntries), tags),
+				gaugeLine(prefix+"hash_limiter.limit", int64(stats.HashLimiter.Limit), tags),
+				gaugeLine(prefix+"hash_limiter.in_flight", int64(stats.HashLimiter.InFlight), tags),
+				gaugeLine(prefix+"hash_limiter.queue_depth", int64(stats.HashLimiter.QueueDepth), tags),
+				fmt.Sprintf("%shash_limiter.shed:%d|c%s", prefix, stats.HashLimiter.ShedTotal-lastShed, tags),
+			}
+			lastShed = stats.HashLimiter.ShedTotal
+
+			if stats.Warmup != nil {
+				metrics = append(metrics,
+					gaugeLine(prefix+"warmup.completed", stats.Warmup.Completed, tags),
+					gaugeLine(prefix+"warmup.failed", stats.Warmup.Failed, tags),
+				)
+			}
+
+			if _, err := conn.Write([]byte(strings.Join(metrics, "\n"))); err != nil {
+				logErrorf("Failed to push StatsD metrics: %v", err)
+			}
+		}
+	}()
+}
+
+func gaugeLine(name string, value int64, tags string) string {
+	return fmt.Sprintf("%s:%d|g%s", name, value, tags)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const subscriptionMaxBodyBytes = 64 << 10
+
+type Subscription struct {
+	ID              string        `json:"id"`
+	URL             string        `json:"url"`
+	WebhookURL      string        `json:"webhook_url"`
+	WebhookSecret   string        `json:"webhook_secret,omitempty"`
+	IntervalSeconds int           `json:"interval_seconds"`
+	LastHash        *HashResponse `json:"last_hash,omitempty"`
+	LastCheckedAt   *time.Time    `json:"last_checked_at,omitempty"`
+	LastError       string        `json:"last_error,omitempty"`
+	NextCheckAt     time.Time     `json:"next_check_at"`
+	CreatedAt       time.Time     `json:"created_at"`
+
+	running bool
+}
+
+type WebhookPayload struct {
+	SubscriptionID string        `json:"subscription_id"`
+	URL            string        `json:"url"`
+	OldHash        *HashResponse `json:"old_hash"`
+	NewHash        HashResponse  `json:"new_hash"`
+	ChangedAt      time.Time     `json:"changed_at"`
+}
+
+var (
+	subscriptions   = make(map[string]*Subscription)
+	subscriptionsMu sync.Mutex
+)
+
+// idempotencyEntry remembers which subscription an Idempotency-Key
+// created, and a digest of the request it came with.
+type idempotencyEntry struct {
+	bodySHA        string
+	subscriptionID string
+	expiresAt      time.Time
+}
+
+var (
+	idempotencyKeys   = make(map[string]*idempotencyEntry)
+	idempotencyKeysMu sync.Mutex
+)
+
+func handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, subscriptionMaxBodyBytes))
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		uploadTooLargeError(subscriptionMaxBodyBytes).write(w)
+		return
+	}
+	if err != nil {
+		(&requestError{status: http.StatusBadRequest, message: "Invalid request body", details: err.Error()}).write(w)
+		return
+	}
+
+	// Retries carrying the same Idempotency-Key (scoped to the caller) get
+	// the subscription created the first time instead of a duplicate.
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		idempotencyKey = requestSubject(r) + "\x00" + idempotencyKey
+		entry, created, reqErr := claimIdempotencyKey(idempotencyKey, sha256Hex(body))
+		if reqErr != nil {
+			reqErr.write(w)
+			return
+		}
+		if !created {
+			subscriptionsMu.Lock()
+			existing, ok := subscriptions[entry.subscriptionID]
+			subscriptionsMu.Unlock()
+			if !ok {
+				(&requestError{status: http.StatusNotFound, message: "Subscription not found", details: entry.subscriptionID}).write(w)
+				return
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, snapshotSubscription(existing))
+			return
+		}
+	}
+
+	// Until the subscription exists, any failure (a panic included) must
+	// release the pending key, or retries would get 409 until it expires.
+	pending := idempotencyKey != ""
+	defer func() {
+		if pending {
+			idempotencyKeysMu.Lock()
+			delete(idempotencyKeys, idempotencyKey)
+			idempotencyKeysMu.Unlock()
+		}
+	}()
+
+	sub, reqErr := createSubscription(body)
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	if pending {
+		idempotencyKeysMu.Lock()
+		idempotencyKeys[idempotencyKey].subscriptionID = sub.ID
+		idempotencyKeysMu.Unlock()
+		pending = false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, snapshotSubscription(sub))
+}
+
+// claimIdempotencyKey returns the entry already stored for key, or stores
+// a new pending one (created == true) that the caller fills in. Entries
+// live for IDEMPOTENCY_TTL_MS (default 24h).
+func claimIdempotencyKey(key string, bodySHA string) (*idempotencyEntry, bool, *requestError) {
+	idempotencyKeysMu.Lock()
+	defer idempotencyKeysMu.Unlock()
+
+	now := time.Now()
+	for k, entry := range idempotencyKeys {
+		if now.After(entry.expiresAt) {
+			delete(idempotencyKeys, k)
+		}
+	}
+
+	if entry, ok := idempotencyKeys[key]; ok {
+		if entry.bodySHA != bodySHA {
+			return nil, false, &requestError{status: http.StatusUnprocessableEntity, message: "Idempotency key reused", details: "the key was used with a different request body"}
+		}
+		if entry.subscriptionID == "" {
+			return nil, false, &requestError{status: http.StatusConflict, message: "Request in progress", details: "a request with this idempotency key is still being processed"}
+		}
+		return entry, false, nil
+	}
+
+	entry := &idempotencyEntry{bodySHA: bodySHA, expiresAt: now.Add(envDuration("IDEMPOTENCY_TTL_MS", 24*time.Hour))}
+	idempotencyKeys[key] = entry
+	return entry, true, nil
+}
+
+func createSubscription(body []byte) (*Subscription, *requestError) {
+	var sub Subscription
+	if err := json.Unmarshal(body, &sub); err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: "Invalid request body", details: err.Error()}
+	}
+
+	if _, err := url.ParseRequestURI(sub.URL); err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: "Invalid URL", details: err.Error()}
+	}
+
+	webhookURL, err := url.ParseRequestURI(sub.WebhookURL)
+	if err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: "Invalid webhook URL", details: err.Error()}
+	}
+	if err := checkFetchURL(webhookURL); err != nil {
+		return nil, &requestError{status: http.StatusForbidden, message: "Webhook URL not allowed", details: err.Error()}
+	}
+
+	minInterval, _ := strconv.Atoi(getEnvDefault("SUBSCRIPTION_MIN_INTERVAL", "60"))
+	if sub.IntervalSeconds < minInterval {
+		sub.IntervalSeconds = minInterval
+	}
+
+	sub.ID = newSubscriptionID()
+	sub.CreatedAt = time.Now().UTC()
+	sub.LastHash = nil
+	sub.LastCheckedAt = nil
+	sub.LastError = ""
+
+	sub.NextCheckAt = sub.CreatedAt
+
+	subscriptionsMu.Lock()
+	subscriptions[sub.ID] = &sub
+	subscriptionsMu.Unlock()
+
+	saveSubscriptions()
+	return &sub, nil
+}
+
+// handleListSubscriptions pages through subscriptions in creation order;
+// see parsePageRequest.
+func handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	page, reqErr := parsePageRequest(r)
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	subscriptionsMu.Lock()
+	list := make([]Subscription, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		snapshot := *sub
+		snapshot.WebhookSecret = ""
+		list = append(list, snapshot)
+	}
+	subscriptionsMu.Unlock()
+
+	list, next := paginate(list, func(sub Subscription) (time.Time, string) { return sub.CreatedAt, sub.ID }, page)
+	setNextPageLink(w, r, next)
+	writeJSON(w, list)
+}
+
+func handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	subscriptionsMu.Lock()
+	_, ok := subscriptions[id]
+	delete(subscriptions, id)
+	subscriptionsMu.Unlock()
+
+	if !ok {
+		(&requestError{status: http.StatusNotFound, message: "Subscription not found", details: id}).write(w)
+		return
+	}
+
+	saveSubscriptions()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snapshotSubscription copies sub for a response, without its webhook
+// secret.
+func snapshotSubscription(sub *Subscription) Subscription {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+	snapshot := *sub
+	snapshot.WebhookSecret = ""
+	return snapshot
+}
+
+func checkSubscription(sub *Subscription) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout())
+	defer cancel()
+
+	hashes, reqErr := refreshURL(ctx, sub.URL)
+
+	now := time.Now().UTC()
+
+	subscriptionsMu.Lock()
+	sub.LastCheckedAt = &now
+	if reqErr != nil {
+		sub.LastError = reqErr.message + ": " + reqErr.details
+		subscriptionsMu.Unlock()
+		return
+	}
+
+	previous := sub.LastHash
+	sub.LastHash = &hashes
+	sub.LastError = ""
+	subscriptionsMu.Unlock()
+
+	if previous == nil || previous.AlphaNormalized == hashes.AlphaNormalized {
+		return
+	}
+
+	payload := WebhookPayload{
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		OldHash:        previous,
+		NewHash:        hashes,
+		ChangedAt:      now,
+	}
+	if err := enqueueWebhook(sub, payload); err != nil {
+		logWarnf("Webhook for subscription %s failed: %v", sub.ID, err)
+	}
+}
+
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSubscriptionID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateSubscriptionRejectsOversizedBody(t *testing.T) {
+	body := `{"url": "` + strings.Repeat("a", subscriptionMaxBodyBytes) + `"}`
+	w := httptest.NewRecorder()
+	handleCreateSubscription(w, httptest.NewRequest("POST", "/subscriptions", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestCreateSubscriptionReleasesIdempotencyKeyOnFailure(t *testing.T) {
+	for attempt := range 2 {
+		r := httptest.NewRequest("POST", "/subscriptions", strings.NewReader(`{"url": "not a url"}`))
+		r.Header.Set("Idempotency-Key", "release-on-failure")
+		w := httptest.NewRecorder()
+		handleCreateSubscription(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: status = %d, want %d", attempt, w.Code, http.StatusBadRequest)
+		}
+	}
+}
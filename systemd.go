@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+)
+
+// systemdListeners returns the sockets passed in by systemd socket
+// activation (LISTEN_PID/LISTEN_FDS, starting at fd 3), or nil when the
+// process wasn't socket-activated. The variables are unset afterwards so
+// child processes don't try to claim the same descriptors.
+func systemdListeners() []net.Listener {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := 3; fd < 3+count; fd++ {
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Failed to use socket-activated fd %d: %v", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+// listen returns the index-th socket-activated listener if systemd passed
+// one in, and otherwise listens on addr itself.
+func listen(activated []net.Listener, index int, addr string) (net.Listener, error) {
+	if index < len(activated) {
+		return activated[index], nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// sdNotify sends state (e.g. "READY=1") to the service manager over
+// NOTIFY_SOCKET. It's a no-op when not running under systemd.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		logErrorf("Failed to notify systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		logErrorf("Failed to notify systemd: %v", err)
+	}
+}
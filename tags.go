@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tag is a moderation label attached to an alpha-normalized hash.
+type Tag struct {
+	Label     string    `json:"label"`
+	Note      string    `json:"note,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type taggedHash struct {
+	Hash string `json:"hash"`
+	Tags []Tag  `json:"tags"`
+}
+
+var tagLabelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// hashTags maps alpha-normalized hashes to their tags. It is kept in
+// TAGS_FILE when that is set.
+var hashTags struct {
+	mu     sync.Mutex
+	byHash map[string][]Tag
+	saveMu sync.Mutex
+}
+
+func loadTags() {
+	hashTags.byHash = make(map[string][]Tag)
+
+	path := getEnvDefault("TAGS_FILE", "")
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Failed to read tags file:", err)
+	}
+
+	var list []taggedHash
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Fatal("Failed to parse tags file:", err)
+	}
+	for _, entry := range list {
+		hashTags.byHash[entry.Hash] = entry.Tags
+	}
+	logInfof("Loaded tags for %d hashes from %s", len(list), path)
+}
+
+func saveTags() {
+	path := getEnvDefault("TAGS_FILE", "")
+	if path == "" {
+		return
+	}
+
+	hashTags.saveMu.Lock()
+	defer hashTags.saveMu.Unlock()
+
+	hashTags.mu.Lock()
+	list := make([]taggedHash, 0, len(hashTags.byHash))
+	for _, hash := range slices.Sorted(maps.Keys(hashTags.byHash)) {
+		list = append(list, taggedHash{Hash: hash, Tags: hashTags.byHash[hash]})
+	}
+	hashTags.mu.Unlock()
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		logErrorf("Failed to encode tags: %v", err)
+		return
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		logErrorf("Failed to write tags file: %v", err)
+	}
+}
+
+func tagsFor(alphaHash string) []Tag {
+	hashTags.mu.Lock()
+	defer hashTags.mu.Unlock()
+	return slices.Clone(hashTags.byHash[alphaHash])
+}
+
+// blockedBy returns the first of tags whose label is listed in
+// BLOCKLIST_TAGS (comma-separated), or "" if none is.
+func blockedBy(tags []Tag) string {
+	blocklist := getEnvDefault("BLOCKLIST_TAGS", "")
+	if blocklist == "" {
+		return ""
+	}
+	for _, tag := range tags {
+		for label := range strings.SplitSeq(blocklist, ",") {
+			if strings.TrimSpace(label) == tag.Label {
+				return tag.Label
+			}
+		}
+	}
+	return ""
+}
+
+// blockError is returned in place of a blocked result when BLOCKLIST_MODE
+// is reject; in the default flag mode the result is returned with
+// blocked: true instead.
+func blockError(label string) *requestError {
+	if getEnvDefault("BLOCKLIST_MODE", "flag") != "reject" {
+		return nil
+	}
+	return &requestError{status: http.StatusUnavailableForLegalReasons, message: "Skin is blocked", details: "tagged " + label}
+}
+
+func handleGetTags(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	tags := tagsFor(hash)
+	if tags == nil {
+		tags = []Tag{}
+	}
+	writeJSON(w, taggedHash{Hash: hash, Tags: tags})
+}
+
+// handleAddTag attaches {"label", "note"} to a hash. Tagging needs an
+// authenticated (JWT) client, whose subject is recorded with the tag and
+// in the audit log. Re-adding a label replaces its note.
+func handleAddTag(w http.ResponseWriter, r *http.Request) {
+	hash, subject, reqErr := tagRequestTarget(r)
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid request body", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	var tag Tag
+	if err := json.Unmarshal(body, &tag); err != nil {
+		http.Error(w, `{"error": "Invalid request body", "details": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	if !tagLabelPattern.MatchString(tag.Label) {
+		http.Error(w, `{"error": "Invalid label", "details": "labels are lowercase letters, digits and dashes, up to 64 characters"}`, http.StatusBadRequest)
+		return
+	}
+	tag.CreatedBy = subject
+	tag.CreatedAt = time.Now().UTC()
+
+	hashTags.mu.Lock()
+	tags := slices.DeleteFunc(hashTags.byHash[hash], func(t Tag) bool { return t.Label == tag.Label })
+	hashTags.byHash[hash] = append(tags, tag)
+	hashTags.mu.Unlock()
+
+	saveTags()
+	auditTagChange(r, subject, hash, tag.Label, http.StatusCreated)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, tag)
+}
+
+func handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	hash, subject, reqErr := tagRequestTarget(r)
+	if reqErr != nil {
+		reqErr.write(w)
+		return
+	}
+	label := r.PathValue("label")
+
+	hashTags.mu.Lock()
+	before := len(hashTags.byHash[hash])
+	tags := slices.DeleteFunc(hashTags.byHash[hash], func(t Tag) bool { return t.Label == label })
+	if len(tags) == 0 {
+		delete(hashTags.byHash, hash)
+	} else {
+		hashTags.byHash[hash] = tags
+	}
+	hashTags.mu.Unlock()
+
+	if len(tags) == before {
+		(&requestError{status: http.StatusNotFound, message: "Tag not found", details: label}).write(w)
+		return
+	}
+
+	saveTags()
+	auditTagChange(r, subject, hash, label, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tagRequestTarget(r *http.Request) (string, string, *requestError) {
+	subject := requestSubject(r)
+	if subject == "" {
+		return "", "", &requestError{status: http.StatusUnauthorized, message: "Unauthorized", details: "tagging requires an authenticated client"}
+	}
+	hash := r.PathValue("hash")
+	if !sha256Pattern.MatchString(hash) {
+		return "", "", &requestError{status: http.StatusBadRequest, message: "Invalid hash", details: "expected a 64-character alpha-normalized hash"}
+	}
+	return hash, subject, nil
+}
+
+func auditTagChange(r *http.Request, subject string, hash string, label string, status int) {
+	if !auditEnabled() {
+		return
+	}
+	channel := "tag"
+	if r.Method == http.MethodDelete {
+		channel = "untag"
+	}
+	writeAuditEntry(AuditEntry{
+		Time:       time.Now().UTC(),
+		Subject:    subject,
+		RemoteAddr: r.RemoteAddr,
+		Channel:    channel,
+		AlphaHash:  hash,
+		Status:     status,
+		Tag:        label,
+	})
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed web/index.html
+var indexHTML []byte
+
+// handleIndex serves the single-page upload UI. It talks to /inspect, so
+// it needs no endpoints of its own.
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
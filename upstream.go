@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var upstreamClient = &http.Client{Timeout: 30 * time.Second}
+
+// upstreamURL is UPSTREAM_URL, the base URL of another namemc-hash-api
+// instance. When set, content missing from the cache is hashed by that
+// instance rather than locally, so an edge deployment always agrees with
+// the central one.
+func upstreamURL() string {
+	return strings.TrimRight(getEnvDefault("UPSTREAM_URL", ""), "/")
+}
+
+// hashFromUpstream asks the upstream for the full result (all optional
+// hashes, conversion allowed) so the local cache can serve any option
+// combination later. It tries content_sha256= first and only uploads the
+// bytes when the upstream hasn't seen them.
+func hashFromUpstream(skinBytes []byte, contentSHA string) (HashResponse, *requestError) {
+	query := url.Values{"convert": {"true"}, "downscale": {"true"}, "analysis": {"true"}, "content_sha256": {contentSHA}}
+	req, err := http.NewRequest(http.MethodGet, upstreamURL()+"/hash?"+query.Encode(), nil)
+	if err != nil {
+		return HashResponse{}, upstreamError(err.Error())
+	}
+
+	hashes, status, reqErr := doUpstreamRequest(req)
+	if status != http.StatusNotFound {
+		return hashes, reqErr
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "skin.png")
+	if err == nil {
+		_, err = part.Write(skinBytes)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return HashResponse{}, upstreamError(err.Error())
+	}
+
+	query.Del("content_sha256")
+	req, err = http.NewRequest(http.MethodPost, upstreamURL()+"/hash?"+query.Encode(), &body)
+	if err != nil {
+		return HashResponse{}, upstreamError(err.Error())
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	hashes, _, reqErr = doUpstreamRequest(req)
+	return hashes, reqErr
+}
+
+// doUpstreamRequest passes client errors (bad dimensions, unsupported
+// types) through with the upstream's status and message, and reports
+// anything else as a 502.
+func doUpstreamRequest(req *http.Request) (HashResponse, int, *requestError) {
+	if token := getEnvDefault("UPSTREAM_TOKEN", ""); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return HashResponse{}, 0, upstreamError(err.Error())
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return HashResponse{}, resp.StatusCode, upstreamError(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error   string `json:"error"`
+			Details string `json:"details"`
+		}
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusUnauthorized &&
+			resp.StatusCode != http.StatusForbidden && json.Unmarshal(data, &body) == nil && body.Error != "" {
+			return HashResponse{}, resp.StatusCode, &requestError{status: resp.StatusCode, message: body.Error, details: body.Details}
+		}
+		return HashResponse{}, resp.StatusCode, upstreamError(resp.Status)
+	}
+
+	var hashes HashResponse
+	if err := json.Unmarshal(data, &hashes); err != nil || hashes.AlphaNormalized == "" {
+		return HashResponse{}, resp.StatusCode, upstreamError("invalid response")
+	}
+	return hashes, resp.StatusCode, nil
+}
+
+func upstreamError(details string) *requestError {
+	return &requestError{status: http.StatusBadGateway, message: "Upstream request failed", details: details}
+}
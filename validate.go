@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxURLLength = 2048
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+var booleanParams = []string{"convert", "downscale", "analysis", "include_source"}
+
+// validateHashRequest checks every query parameter of a /hash-style
+// request up front and reports all problems at once as a 422, instead of
+// failing on the first one somewhere down the line.
+func validateHashRequest(r *http.Request) *requestError {
+	query := r.URL.Query()
+	var errs []fieldError
+
+	var inputs []string
+	if query.Get("url") != "" {
+		inputs = append(inputs, "url")
+	}
+	if query.Get("source") != "" {
+		inputs = append(inputs, "source")
+	}
+	if query.Get("content_sha256") != "" {
+		inputs = append(inputs, "content_sha256")
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		inputs = append(inputs, "file")
+	}
+	switch {
+	case len(inputs) == 0 && r.Method != http.MethodGet && r.Method != http.MethodHead:
+		errs = append(errs, fieldError{Field: "file", Message: "a file upload, url, source or content_sha256 is required"})
+	case len(inputs) == 0:
+		errs = append(errs, fieldError{Field: "url", Message: "a url, source or content_sha256 is required"})
+	case len(inputs) > 1:
+		errs = append(errs, fieldError{Field: inputs[1], Message: "only one of " + strings.Join(inputs, ", ") + " may be given"})
+	}
+
+	if rawURL := query.Get("url"); len(rawURL) > maxURLLength {
+		errs = append(errs, fieldError{Field: "url", Message: fmt.Sprintf("must be at most %d characters", maxURLLength)})
+	}
+
+	if contentSHA := query.Get("content_sha256"); contentSHA != "" && !sha256Pattern.MatchString(contentSHA) {
+		errs = append(errs, fieldError{Field: "content_sha256", Message: "must be 64 hex characters"})
+	}
+
+	if source := query.Get("source"); source != "" {
+		name, id, _ := strings.Cut(source, ":")
+		if adapter, ok := sourceAdapters[strings.ToLower(name)]; !ok {
+			errs = append(errs, fieldError{Field: "source", Message: "unknown source adapter " + strconv.Quote(name)})
+		} else if !adapter.pattern.MatchString(id) {
+			errs = append(errs, fieldError{Field: "source", Message: "invalid " + name + " id"})
+		}
+	}
+
+	if limit := maxUploadBytes(); r.ContentLength > limit+multipartOverheadBytes {
+		errs = append(errs, fieldError{Field: "file", Message: fmt.Sprintf("must be at most %d bytes", limit)})
+	}
+
+	for _, name := range booleanParams {
+		if value := query.Get(name); value != "" && value != "true" && value != "false" {
+			errs = append(errs, fieldError{Field: name, Message: "must be true or false"})
+		}
+	}
+
+	if skip := query.Get("skip"); skip != "" {
+		for value := range strings.SplitSeq(skip, ",") {
+			if value != "" && value != "standard" {
+				errs = append(errs, fieldError{Field: "skip", Message: "unknown value " + strconv.Quote(value)})
+			}
+		}
+	}
+
+	if fields := query.Get("fields"); fields != "" {
+		known := responseFields()
+		for field := range strings.SplitSeq(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" && !known[field] {
+				errs = append(errs, fieldError{Field: "fields", Message: "unknown field " + strconv.Quote(field)})
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &requestError{status: http.StatusUnprocessableEntity, message: "Validation failed", details: errs[0].Field + ": " + errs[0].Message, fields: errs}
+}
+
+// multipartOverheadBytes is how far a multipart body may exceed
+// MAX_UPLOAD_BYTES to leave room for boundaries and part headers.
+const multipartOverheadBytes = 64 << 10
+
+func uploadTooLargeError(limit int64) *requestError {
+	return &requestError{status: http.StatusRequestEntityTooLarge, message: "File too large", details: fmt.Sprintf("uploads are limited to %d bytes", limit)}
+}
+
+// multipartMemoryBytes is MULTIPART_MEMORY_BYTES, 1 MiB by default.
+func multipartMemoryBytes() int64 {
+	limit, err := strconv.ParseInt(getEnvDefault("MULTIPART_MEMORY_BYTES", "1048576"), 10, 64)
+	if err != nil || limit <= 0 {
+		return 1 << 20
+	}
+	return limit
+}
+
+var errImageTooLarge = errors.New("image too large")
+
+// maxImagePixels is MAX_IMAGE_PIXELS, 16777216 (4096x4096) by default.
+// MAX_UPLOAD_BYTES doesn't bound decoding: a few bytes of PNG header can
+// declare a canvas image.Decode allocates in full.
+func maxImagePixels() int64 {
+	limit, err := strconv.ParseInt(getEnvDefault("MAX_IMAGE_PIXELS", "16777216"), 10, 64)
+	if err != nil || limit <= 0 {
+		return 4096 * 4096
+	}
+	return limit
+}
+
+// checkImageSize rejects images whose header declares more than
+// maxImagePixels, so they are refused before anything is decoded.
+func checkImageSize(config image.Config) error {
+	if limit := maxImagePixels(); int64(config.Width)*int64(config.Height) > limit {
+		return fmt.Errorf("%w: %dx%d exceeds %d pixels", errImageTooLarge, config.Width, config.Height, limit)
+	}
+	return nil
+}
+
+// maxUploadBytes is MAX_UPLOAD_BYTES, 8 MiB by default.
+func maxUploadBytes() int64 {
+	limit, err := strconv.ParseInt(getEnvDefault("MAX_UPLOAD_BYTES", "8388608"), 10, 64)
+	if err != nil || limit <= 0 {
+		return 8 << 20
+	}
+	return limit
+}
+
+// responseFields lists the keys fields= may select: everything a hash
+// response can contain, plus /inspect's and include_source's additions.
+func responseFields() map[string]bool {
+	known := map[string]bool{"source": true, "png": true}
+	hashType := reflect.TypeFor[HashResponse]()
+	for i := range hashType.NumField() {
+		name, _, _ := strings.Cut(hashType.Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+	return known
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// headerOnlyPNG returns a PNG whose IHDR declares width x height but
+// whose IDAT holds a single row, a few dozen bytes in total.
+func headerOnlyPNG(width uint32, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+
+	var idat bytes.Buffer
+	zw := zlib.NewWriter(&idat)
+	zw.Write(make([]byte, 1+int(width)*4))
+	zw.Close()
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	writePNGChunk(&buf, "IHDR", ihdr)
+	writePNGChunk(&buf, "IDAT", idat.Bytes())
+	writePNGChunk(&buf, "IEND", nil)
+	return buf.Bytes()
+}
+
+func TestComputeHashesRejectsOversizedImages(t *testing.T) {
+	_, err := computeHashes(headerOnlyPNG(20000, 20000), hashOptions{})
+	if !errors.Is(err, errImageTooLarge) {
+		t.Fatalf("err = %v, want errImageTooLarge", err)
+	}
+	if reqErr := hashError(err); reqErr.status != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", reqErr.status, http.StatusRequestEntityTooLarge)
+	}
+}
+
+// The IDAT holds one row, so getting errInvalidDimensions rather than a
+// decode error shows the size was checked before decoding.
+func TestComputeHashesChecksSkinDimensionsBeforeDecoding(t *testing.T) {
+	_, err := computeHashes(headerOnlyPNG(128, 4096), hashOptions{})
+	if !errors.Is(err, errInvalidDimensions) {
+		t.Fatalf("err = %v, want errInvalidDimensions", err)
+	}
+}
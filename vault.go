@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var vaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// loadVaultSecrets reads secretEnvKeys from the Vault KV v2 secret at
+// VAULT_SECRET_PATH (e.g. "secret/data/namemc-hash-api") when VAULT_ADDR
+// is set, then renews VAULT_TOKEN and re-reads the secret every
+// VAULT_REFRESH_MS (default 5 minutes). Values read per request (admin
+// token, webhook and captcha secrets, MineSkin key) pick up rotations;
+// the JWT secret and peer token are fixed at startup.
+func loadVaultSecrets() {
+	if getEnvDefault("VAULT_ADDR", "") == "" {
+		return
+	}
+
+	count, err := readVaultSecrets()
+	if err != nil {
+		log.Fatal("Failed to load secrets from Vault: ", err)
+	}
+	logInfof("Loaded %d secrets from Vault", count)
+
+	go func() {
+		ticker := time.NewTicker(envDuration("VAULT_REFRESH_MS", 5*time.Minute))
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := vaultRequest(http.MethodPost, "auth/token/renew-self", nil); err != nil {
+				logErrorf("Failed to renew Vault token: %v", err)
+			}
+			if _, err := readVaultSecrets(); err != nil {
+				logErrorf("Failed to refresh secrets from Vault: %v", err)
+			}
+		}
+	}()
+}
+
+func readVaultSecrets() (int, error) {
+	var secret struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	path := strings.Trim(getEnvDefault("VAULT_SECRET_PATH", "secret/data/namemc-hash-api"), "/")
+	if err := vaultRequest(http.MethodGet, path, &secret); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, key := range secretEnvKeys {
+		if key == "VAULT_TOKEN" {
+			continue
+		}
+		if value, ok := secret.Data.Data[key]; ok {
+			setEnv(key, value)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func vaultRequest(method string, path string, out any) error {
+	req, err := http.NewRequest(method, strings.TrimRight(getEnv("VAULT_ADDR"), "/")+"/v1/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", getEnvDefault("VAULT_TOKEN", ""))
+	if namespace := getEnvDefault("VAULT_NAMESPACE", ""); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: unexpected status %d", method, path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
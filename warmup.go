@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var textureIDPattern = regexp.MustCompile(`^[0-9a-f]{32,64}$`)
+
+type warmupStats struct {
+	Total     int64 `json:"total"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+	Done      bool  `json:"done"`
+}
+
+var warmup struct {
+	total     atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+	done      atomic.Bool
+	enabled   atomic.Bool
+}
+
+// startWarmup pre-hashes every URL (or bare textures.minecraft.net texture
+// id) listed one per line in WARMUP_FILE, in the background.
+func startWarmup() {
+	path := getEnvDefault("WARMUP_FILE", "")
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		logErrorf("Failed to open warmup file: %v", err)
+		return
+	}
+	defer file.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if textureIDPattern.MatchString(line) {
+			line = "https://textures.minecraft.net/texture/" + line
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		logErrorf("Failed to read warmup file: %v", err)
+		return
+	}
+
+	concurrency, err := strconv.Atoi(getEnvDefault("WARMUP_CONCURRENCY", "4"))
+	if err != nil || concurrency < 1 {
+		concurrency = 1
+	}
+
+	warmup.enabled.Store(true)
+	warmup.total.Store(int64(len(urls)))
+	logInfof("Warming cache with %d URLs", len(urls))
+
+	go func() {
+		jobs := make(chan string)
+		var wg sync.WaitGroup
+		for range concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for rawURL := range jobs {
+					ctx, cancel := context.WithTimeout(context.Background(), requestTimeout())
+					_, _, reqErr := hashURL(ctx, rawURL, hashOptions{})
+					cancel()
+					if reqErr != nil {
+						warmup.failed.Add(1)
+					} else {
+						warmup.completed.Add(1)
+					}
+				}
+			}()
+		}
+
+		for _, rawURL := range urls {
+			jobs <- rawURL
+		}
+		close(jobs)
+		wg.Wait()
+
+		warmup.done.Store(true)
+		logInfof("Cache warmup finished: %d completed, %d failed", warmup.completed.Load(), warmup.failed.Load())
+	}()
+}
+
+func currentWarmupStats() *warmupStats {
+	if !warmup.enabled.Load() {
+		return nil
+	}
+
+	return &warmupStats{
+		Total:     warmup.total.Load(),
+		Completed: warmup.completed.Load(),
+		Failed:    warmup.failed.Load(),
+		Done:      warmup.done.Load(),
+	}
+}
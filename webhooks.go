@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WebhookDelivery is one webhook payload on its way to an endpoint. Its
+// ID is sent as X-Webhook-Id on every attempt, so receivers can drop
+// duplicates of a delivery that was retried after a lost response.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+
+	secret string
+}
+
+// webhookClient goes through the same outbound rules as skin fetches:
+// the dialer enforces BLOCK_PRIVATE_NETWORKS and every redirect hop is
+// rechecked against ALLOWED_HOSTS, since clients choose webhook URLs.
+var webhookClient = &http.Client{Transport: newFetchTransport(), CheckRedirect: checkRedirect, Timeout: 10 * time.Second}
+
+// Pending deliveries are retried with exponential backoff from
+// WEBHOOK_RETRY_BASE_MS (default 1s, capped at an hour) until
+// WEBHOOK_MAX_ATTEMPTS (default 8) have failed; they then move to the
+// dead letters, kept in WEBHOOK_DEAD_LETTER_FILE when set.
+var webhooks struct {
+	mu          sync.Mutex
+	pending     []*WebhookDelivery
+	deadLetters []*WebhookDelivery
+	saveMu      sync.Mutex
+}
+
+func startWebhookDelivery() {
+	loadDeadLetters()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			dispatchDueWebhooks()
+		}
+	}()
+}
+
+// enqueueWebhook queues payload for delivery to sub's webhook URL, signed
+// with the subscription's own secret or else WEBHOOK_SECRET.
+func enqueueWebhook(sub *Subscription, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	secret := sub.WebhookSecret
+	if secret == "" {
+		secret = getEnvDefault("WEBHOOK_SECRET", "")
+	}
+
+	now := time.Now().UTC()
+	delivery := &WebhookDelivery{
+		ID:             newSubscriptionID(),
+		SubscriptionID: sub.ID,
+		URL:            sub.WebhookURL,
+		Payload:        body,
+		CreatedAt:      now,
+		NextAttemptAt:  now,
+		secret:         secret,
+	}
+
+	webhooks.mu.Lock()
+	webhooks.pending = append(webhooks.pending, delivery)
+	webhooks.mu.Unlock()
+	return nil
+}
+
+func dispatchDueWebhooks() {
+	now := time.Now()
+
+	webhooks.mu.Lock()
+	var due []*WebhookDelivery
+	remaining := webhooks.pending[:0]
+	for _, delivery := range webhooks.pending {
+		if now.Before(delivery.NextAttemptAt) {
+			remaining = append(remaining, delivery)
+		} else {
+			due = append(due, delivery)
+		}
+	}
+	webhooks.pending = remaining
+	webhooks.mu.Unlock()
+
+	for _, delivery := range due {
+		go attemptWebhook(delivery)
+	}
+}
+
+func attemptWebhook(delivery *WebhookDelivery) {
+	err := deliverWebhook(delivery)
+
+	webhooks.mu.Lock()
+	defer webhooks.mu.Unlock()
+
+	delivery.Attempts++
+	if err == nil {
+		return
+	}
+	delivery.LastError = err.Error()
+
+	maxAttempts, _ := strconv.Atoi(getEnvDefault("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if delivery.Attempts >= maxAttempts {
+		logErrorf("Webhook delivery %s for subscription %s failed permanently: %v", delivery.ID, delivery.SubscriptionID, err)
+		webhooks.deadLetters = append(webhooks.deadLetters, delivery)
+		go saveDeadLetters()
+		return
+	}
+
+	backoff := envDuration("WEBHOOK_RETRY_BASE_MS", time.Second) << (delivery.Attempts - 1)
+	if backoff <= 0 || backoff > time.Hour {
+		backoff = time.Hour
+	}
+	delivery.NextAttemptAt = time.Now().UTC().Add(backoff)
+	webhooks.pending = append(webhooks.pending, delivery)
+}
+
+// deliverWebhook POSTs the payload once. Besides the legacy
+// X-Signature-256 (HMAC of the body), X-Webhook-Signature signs
+// "<id>.<timestamp>.<body>", so a captured request can't be replayed
+// later as new.
+func deliverWebhook(delivery *WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookClient.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	if err := checkFetchURL(req.URL); err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", delivery.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if delivery.secret != "" {
+		req.Header.Set("X-Signature-256", "sha256="+signWebhook(delivery.secret, delivery.Payload))
+		signed := append([]byte(delivery.ID+"."+timestamp+"."), delivery.Payload...)
+		req.Header.Set("X-Webhook-Signature", "v1="+signWebhook(delivery.secret, signed))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type WebhookQueue struct {
+	Pending     []WebhookDelivery `json:"pending"`
+	DeadLetters []WebhookDelivery `json:"dead_letters"`
+}
+
+func handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks.mu.Lock()
+	queue := WebhookQueue{
+		Pending:     make([]WebhookDelivery, 0, len(webhooks.pending)),
+		DeadLetters: make([]WebhookDelivery, 0, len(webhooks.deadLetters)),
+	}
+	for _, delivery := range webhooks.pending {
+		queue.Pending = append(queue.Pending, *delivery)
+	}
+	for _, delivery := range webhooks.deadLetters {
+		queue.DeadLetters = append(queue.DeadLetters, *delivery)
+	}
+	webhooks.mu.Unlock()
+
+	writeJSON(w, queue)
+}
+
+// handleRetryWebhook moves a dead letter back to the pending queue with a
+// fresh attempt budget.
+func handleRetryWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	webhooks.mu.Lock()
+	i := slices.IndexFunc(webhooks.deadLetters, func(d *WebhookDelivery) bool { return d.ID == id })
+	if i < 0 {
+		webhooks.mu.Unlock()
+		(&requestError{status: http.StatusNotFound, message: "Delivery not found", details: id}).write(w)
+		return
+	}
+	delivery := webhooks.deadLetters[i]
+	webhooks.deadLetters = slices.Delete(webhooks.deadLetters, i, i+1)
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	webhooks.pending = append(webhooks.pending, delivery)
+	webhooks.mu.Unlock()
+
+	saveDeadLetters()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deadLetterRecord is a dead letter as stored on disk; unlike the admin
+// view it includes the signing secret so a retry is signed the same way.
+type deadLetterRecord struct {
+	WebhookDelivery
+	Secret string `json:"secret,omitempty"`
+}
+
+func loadDeadLetters() {
+	path := getEnvDefault("WEBHOOK_DEAD_LETTER_FILE", "")
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Failed to read webhook dead letter file:", err)
+	}
+
+	var records []deadLetterRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		log.Fatal("Failed to parse webhook dead letter file:", err)
+	}
+
+	webhooks.mu.Lock()
+	for _, record := range records {
+		delivery := record.WebhookDelivery
+		delivery.secret = record.Secret
+		webhooks.deadLetters = append(webhooks.deadLetters, &delivery)
+	}
+	webhooks.mu.Unlock()
+}
+
+func saveDeadLetters() {
+	path := getEnvDefault("WEBHOOK_DEAD_LETTER_FILE", "")
+	if path == "" {
+		return
+	}
+
+	webhooks.saveMu.Lock()
+	defer webhooks.saveMu.Unlock()
+
+	webhooks.mu.Lock()
+	records := make([]deadLetterRecord, 0, len(webhooks.deadLetters))
+	for _, delivery := range webhooks.deadLetters {
+		records = append(records, deadLetterRecord{WebhookDelivery: *delivery, Secret: delivery.secret})
+	}
+	webhooks.mu.Unlock()
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		logErrorf("Failed to encode webhook dead letters: %v", err)
+		return
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		logErrorf("Failed to write webhook dead letter file: %v", err)
+	}
+}
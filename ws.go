@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	wsMaxInFlight     = 8
+	wsMaxPayloadBytes = 8 << 20
+)
+
+type wsRequest struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Convert bool   `json:"convert"`
+}
+
+// wsResponse carries Result as the exact bytes Signature covers, since a
+// frame has no headers to put a writeSignedJSON signature in.
+type wsResponse struct {
+	Seq       int             `json:"seq"`
+	ID        string          `json:"id,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	KeyID     string          `json:"key_id,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Details   string          `json:"details,omitempty"`
+}
+
+type wsFrame struct {
+	payloadType byte
+	data        []byte
+}
+
+var wsFrameCodec = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		data, err := json.Marshal(v)
+		return data, websocket.TextFrame, err
+	},
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		frame := v.(*wsFrame)
+		frame.payloadType = payloadType
+		frame.data = data
+		return nil
+	},
+}
+
+// Text frames carry a JSON wsRequest, binary frames carry raw PNG bytes.
+// Responses are sent as they complete and are matched up by seq (and id, if given).
+// Requests still running when the client disconnects are cancelled.
+func handleWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = wsMaxPayloadBytes
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, wsMaxInFlight)
+
+	send := func(resp wsResponse) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		wsFrameCodec.Send(ws, resp)
+	}
+
+	for seq := 0; ; seq++ {
+		var frame wsFrame
+		if err := wsFrameCodec.Receive(ws, &frame); err != nil {
+			break
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(seq int, frame wsFrame) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			send(processWebSocketFrame(ctx, ws.Request(), seq, frame))
+		}(seq, frame)
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func processWebSocketFrame(ctx context.Context, r *http.Request, seq int, frame wsFrame) (resp wsResponse) {
+	resp.Seq = seq
+	defer func() {
+		if rec := recover(); rec != nil {
+			resp.Result, resp.Signature, resp.KeyID = nil, "", ""
+			resp.Error = "Internal server error"
+			resp.Details = fmt.Sprintf("%v", rec)
+		}
+	}()
+
+	started := time.Now()
+	var hashes HashResponse
+	var source SourceInfo
+	var reqErr *requestError
+	var sourceURL string
+	var upload []byte
+
+	if frame.payloadType == websocket.BinaryFrame {
+		upload = frame.data
+		reqErr = checkUploadType(upload, "", hashOptions{})
+		if reqErr == nil {
+			hashes, source, reqErr = hashUpload(upload, hashOptions{})
+		}
+	} else {
+		var req wsRequest
+		if err := json.Unmarshal(frame.data, &req); err != nil {
+			resp.Error = "Invalid request"
+			resp.Details = err.Error()
+			return resp
+		}
+		resp.ID = req.ID
+		if req.URL == "" {
+			resp.Error = "Invalid request"
+			resp.Details = "url is required"
+			return resp
+		}
+		ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+		defer cancel()
+		sourceURL = req.URL
+		hashes, source, reqErr = hashURL(ctx, sourceURL, hashOptions{convert: req.Convert})
+	}
+
+	auditHashRequest(r, "websocket", sourceURL, upload, hashes, reqErr)
+	emitHashEvent("websocket", sourceURL, hashes, source, started, reqErr)
+	trackHashRequest(r, "websocket", sourceURL, reqErr)
+	if reqErr != nil {
+		resp.Error = reqErr.message
+		resp.Details = reqErr.details
+		return resp
+	}
+
+	result, err := json.Marshal(hashes)
+	if err != nil {
+		resp.Error = "Failed to encode response"
+		resp.Details = err.Error()
+		return resp
+	}
+	resp.Result = result
+	resp.Signature, resp.KeyID = signBody(result)
+	return resp
+}
+
+// checkWebSocketOrigin lets browsers open the socket only from the API's
+// own origin or one listed in WS_ALLOWED_ORIGINS (comma-separated, e.g.
+// https://skins.example.com), so other pages can't use a visitor's
+// credentials. Clients that send no Origin header aren't browsers and
+// are let through.
+func checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == r.Host {
+		return nil
+	}
+	for allowed := range strings.SplitSeq(getEnvDefault("WS_ALLOWED_ORIGINS", ""), ",") {
+		if strings.TrimRight(strings.TrimSpace(allowed), "/") == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+var webSocketHandler http.Handler = websocket.Server{Handler: handleWebSocket, Handshake: checkWebSocketOrigin}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	setEnv("WS_ALLOWED_ORIGINS", "https://skins.example.com/, https://other.example.com")
+	defer setEnv("WS_ALLOWED_ORIGINS", "")
+
+	cases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{"http://api.example.com", true},
+		{"https://skins.example.com", true},
+		{"https://other.example.com", true},
+		{"https://evil.example.com", false},
+		{"https://api.example.com.evil.test", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "http://api.example.com/ws", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		err := checkWebSocketOrigin(nil, r)
+		if (err == nil) != c.allowed {
+			t.Errorf("origin %q: got err %v, want allowed=%v", c.origin, err, c.allowed)
+		}
+	}
+}